@@ -0,0 +1,113 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// KeyPrefix 所有API密钥的前缀，格式：nono_<prefix>_<secret>
+const KeyPrefix = "nono_"
+
+var (
+	// ErrInvalidKey 密钥格式错误、不存在或哈希不匹配
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrKeyUnusable 密钥已吊销或已过期
+	ErrKeyUnusable = errors.New("api key revoked or expired")
+	// ErrOwnerInactive 绑定的身份不存在或已被禁用
+	ErrOwnerInactive = errors.New("api key owner inactive")
+)
+
+// Service API密钥管理
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建API密钥服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// IsAPIKey 判断凭证是否为API密钥格式
+func IsAPIKey(raw string) bool {
+	return strings.HasPrefix(raw, KeyPrefix)
+}
+
+// Generate 生成新的密钥，返回明文密钥、公开前缀和哈希
+func Generate() (plaintext, prefix, hash string, err error) {
+	prefixBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	secret := hex.EncodeToString(secretBytes)
+	return KeyPrefix + prefix + "_" + secret, prefix, hashSecret(secret), nil
+}
+
+// Authenticate 验证明文密钥，返回密钥记录和绑定的用户
+func (s *Service) Authenticate(raw, clientIP string) (*models.APIKey, *models.User, error) {
+	prefix, secret, ok := split(raw)
+	if !ok {
+		return nil, nil, ErrInvalidKey
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrInvalidKey
+		}
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.KeyHash)) != 1 {
+		return &key, nil, ErrInvalidKey
+	}
+
+	now := time.Now()
+	if !key.IsUsable(now) {
+		return &key, nil, ErrKeyUnusable
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ? AND is_active = ?", key.UserID, true).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &key, nil, ErrOwnerInactive
+		}
+		return &key, nil, err
+	}
+
+	s.db.Model(&key).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP})
+
+	return &key, &user, nil
+}
+
+// split 解析 nono_<prefix>_<secret>
+func split(raw string) (prefix, secret string, ok bool) {
+	if !IsAPIKey(raw) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(raw, KeyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
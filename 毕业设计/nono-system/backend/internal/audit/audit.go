@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// Record 写入审计日志，操作者取自请求上下文中的已认证用户
+// 审计写入失败只记录日志，不影响业务请求
+func Record(db *gorm.DB, c *gin.Context, action, resource string, success bool, detail string) {
+	var actorID uint
+	var actor string
+	if user, exists := c.Get("user"); exists {
+		u := user.(*models.User)
+		actorID = u.ID
+		actor = u.Username
+	}
+	RecordAs(db, c, actorID, actor, action, resource, success, detail)
+}
+
+// RecordAs 以指定操作者写入审计日志，用于登录等尚未认证的请求
+func RecordAs(db *gorm.DB, c *gin.Context, actorID uint, actor, action, resource string, success bool, detail string) {
+	entry := models.AuditLog{
+		ActorID:   actorID,
+		Actor:     actor,
+		Action:    action,
+		Resource:  resource,
+		Success:   success,
+		Detail:    detail,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		CreatedAt: time.Now(),
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log (action=%s, resource=%s): %v", action, resource, err)
+	}
+}
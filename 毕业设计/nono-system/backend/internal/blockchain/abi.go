@@ -25,6 +25,17 @@ const DeviceIdentityABI = `[
 		"stateMutability": "nonpayable",
 		"type": "function"
 	},
+	{
+		"inputs": [
+			{"internalType": "string", "name": "_did", "type": "string"},
+			{"internalType": "string", "name": "_fromDomain", "type": "string"},
+			{"internalType": "string", "name": "_toDomain", "type": "string"}
+		],
+		"name": "transferDevice",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
 	{
 		"inputs": [
 			{"internalType": "string", "name": "", "type": "string"}
@@ -62,6 +73,17 @@ const DeviceIdentityABI = `[
 		],
 		"name": "CrossDomainAuthCompleted",
 		"type": "event"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{"indexed": true, "internalType": "string", "name": "did", "type": "string"},
+			{"indexed": false, "internalType": "string", "name": "fromDomain", "type": "string"},
+			{"indexed": false, "internalType": "string", "name": "toDomain", "type": "string"},
+			{"indexed": false, "internalType": "uint256", "name": "timestamp", "type": "uint256"}
+		],
+		"name": "DeviceTransferred",
+		"type": "event"
 	}
 ]`
 
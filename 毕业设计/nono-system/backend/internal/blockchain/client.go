@@ -162,6 +162,50 @@ func (c *Client) RequestCrossDomainAuth(did, sourceDomain, targetDomain string)
 	return signedTx.Hash().Hex(), authorized, nil
 }
 
+// TransferDevice 在链上记录设备迁移到其他域，返回交易哈希
+// 需要配置私钥，且该地址是合约的授权管理员
+func (c *Client) TransferDevice(did, fromDomain, toDomain string) (string, error) {
+	if c == nil || c.client == nil {
+		return "", fmt.Errorf("blockchain client not initialized")
+	}
+	if c.privateKey == nil {
+		return "", fmt.Errorf("blockchain private key not configured")
+	}
+
+	data, err := c.contractABI.Pack("transferDevice", did, fromDomain, toDomain)
+	if err != nil {
+		return "", fmt.Errorf("failed to pack function call: %w", err)
+	}
+
+	nonce, err := c.client.PendingNonceAt(context.Background(), c.auth.From)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %w", err)
+	}
+	gasPrice, err := c.client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	tx := types.NewTransaction(nonce, c.contractAddr, nil, 200000, gasPrice, data)
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(c.chainID), c.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	if err := c.client.SendTransaction(context.Background(), signedTx); err != nil {
+		return "", fmt.Errorf("failed to send transaction: %w", err)
+	}
+
+	receipt, err := bind.WaitMined(context.Background(), c.client, signedTx)
+	if err != nil {
+		return "", fmt.Errorf("failed to wait for transaction: %w", err)
+	}
+	if receipt.Status == 0 {
+		return signedTx.Hash().Hex(), fmt.Errorf("transaction failed")
+	}
+
+	return signedTx.Hash().Hex(), nil
+}
+
 // GetTransactionReceipt 获取交易收据
 func (c *Client) GetTransactionReceipt(txHash string) (*types.Receipt, error) {
 	if c == nil || c.client == nil {
@@ -12,12 +12,16 @@ type Config struct {
 	Blockchain BlockchainConfig
 	Database   DatabaseConfig
 	Redis      RedisConfig
+	Auth       AuthConfig
 }
 
 type ServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
 	Mode string `mapstructure:"mode"` // "debug", "release"
+	// PublicURL 对外访问地址（如 https://nono.example.com），用于 DID 文档中的服务端点；
+	// 为空时根据请求的 Host 推断
+	PublicURL string `mapstructure:"public_url"`
 }
 
 type BlockchainConfig struct {
@@ -42,6 +46,46 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"db"`
 }
 
+type AuthConfig struct {
+	Issuer             string `mapstructure:"issuer"`
+	SigningMethod      string `mapstructure:"signing_method"`       // "HS256" 或 "EdDSA"
+	JWTSecret          string `mapstructure:"jwt_secret"`           // HS256 密钥
+	Ed25519PrivateKey  string `mapstructure:"ed25519_private_key"`  // EdDSA 私钥种子（hex，32字节）
+	AccessTokenTTL     int    `mapstructure:"access_token_ttl"`     // 访问令牌有效期（分钟）
+	RefreshTokenTTL    int    `mapstructure:"refresh_token_ttl"`    // 刷新令牌有效期（小时）
+	SessionMaxLifetime int    `mapstructure:"session_max_lifetime"` // 会话最长有效期（小时），从登录时起算，刷新不能延长
+	SessionStore       string `mapstructure:"session_store"`        // 会话存储："postgres" 或 "redis"
+	Registration       string `mapstructure:"registration"`         // 注册策略："open"（公开注册普通用户）或 "invite_only"
+
+	// 首个管理员：系统中还没有管理员时，启动时用该账号创建；用户名为空则不创建
+	AdminUsername string `mapstructure:"admin_username"`
+	AdminPassword string `mapstructure:"admin_password"`
+	AdminEmail    string `mapstructure:"admin_email"`
+
+	// 登录防暴力破解
+	LoginLimiter          string `mapstructure:"login_limiter"`             // 失败计数存储："memory" 或 "redis"
+	LoginMaxAttempts      int    `mapstructure:"login_max_attempts"`        // 同一用户名连续失败多少次后锁定
+	LoginMaxAttemptsPerIP int    `mapstructure:"login_max_attempts_per_ip"` // 同一IP连续失败多少次后锁定
+	LoginLockoutBase      int    `mapstructure:"login_lockout_base"`        // 首次锁定时长（秒），此后每次失败翻倍
+	LoginLockoutMax       int    `mapstructure:"login_lockout_max"`         // 最长锁定时长（秒）
+
+	// 双因素认证
+	Require2FA bool `mapstructure:"require_2fa"` // 是否强制管理员和审计员启用双因素认证
+
+	RBACCacheTTL int `mapstructure:"rbac_cache_ttl"` // 角色权限缓存有效期（秒）
+
+	// 设备签名认证
+	RequireDeviceSignature bool `mapstructure:"require_device_signature"` // 跨域认证是否必须附带设备对挑战的签名
+	DeviceChallengeTTL     int  `mapstructure:"device_challenge_ttl"`     // 设备认证挑战有效期（秒）
+
+	// 跨域认证凭证
+	CredentialPrivateKey string `mapstructure:"credential_private_key"` // 凭证签名私钥种子（hex，32字节，Ed25519）
+	CredentialTTL        int    `mapstructure:"credential_ttl"`         // 凭证有效期（分钟）
+
+	// 跨域授权
+	GrantTTL int `mapstructure:"grant_ttl"` // 跨域授权默认有效期（分钟）
+}
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -83,6 +127,24 @@ func setDefaults() {
 	viper.SetDefault("database.db_name", "nono_system")
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
+	viper.SetDefault("auth.issuer", "nono-system")
+	viper.SetDefault("auth.signing_method", "HS256")
+	viper.SetDefault("auth.access_token_ttl", 30)
+	viper.SetDefault("auth.refresh_token_ttl", 168)
+	viper.SetDefault("auth.session_max_lifetime", 720)
+	viper.SetDefault("auth.session_store", "postgres")
+	viper.SetDefault("auth.registration", "open")
+	viper.SetDefault("auth.login_limiter", "memory")
+	viper.SetDefault("auth.login_max_attempts", 5)
+	viper.SetDefault("auth.login_max_attempts_per_ip", 20)
+	viper.SetDefault("auth.login_lockout_base", 60)
+	viper.SetDefault("auth.login_lockout_max", 3600)
+	viper.SetDefault("auth.require_2fa", false)
+	viper.SetDefault("auth.rbac_cache_ttl", 60)
+	viper.SetDefault("auth.require_device_signature", false)
+	viper.SetDefault("auth.device_challenge_ttl", 120)
+	viper.SetDefault("auth.credential_ttl", 60)
+	viper.SetDefault("auth.grant_ttl", 60)
 }
 
 func overrideFromEnv(cfg *Config) {
@@ -104,5 +166,28 @@ func overrideFromEnv(cfg *Config) {
 	if rpcURL := os.Getenv("BLOCKCHAIN_RPC_URL"); rpcURL != "" {
 		cfg.Blockchain.RPCURL = rpcURL
 	}
+	if host := os.Getenv("REDIS_HOST"); host != "" {
+		cfg.Redis.Host = host
+	}
+	if port := os.Getenv("REDIS_PORT"); port != "" {
+		fmt.Sscanf(port, "%d", &cfg.Redis.Port)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		cfg.Auth.JWTSecret = secret
+	}
+	if key := os.Getenv("JWT_ED25519_PRIVATE_KEY"); key != "" {
+		cfg.Auth.Ed25519PrivateKey = key
+	}
+	if key := os.Getenv("CREDENTIAL_ED25519_PRIVATE_KEY"); key != "" {
+		cfg.Auth.CredentialPrivateKey = key
+	}
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		cfg.Auth.AdminUsername = username
+	}
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		cfg.Auth.AdminPassword = password
+	}
+	if email := os.Getenv("ADMIN_EMAIL"); email != "" {
+		cfg.Auth.AdminEmail = email
+	}
 }
-
@@ -1,13 +1,18 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
 	"nono-system/backend/internal/config"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/rbac"
+	"nono-system/backend/internal/search"
 )
 
 // DB 数据库实例
@@ -25,11 +30,26 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 设备元数据由 text 转换为 jsonb，须在自动迁移之前执行
+	if err := migrateDeviceMetadata(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate device metadata: %w", err)
+	}
+
 	// 自动迁移
 	if err := autoMigrate(db); err != nil {
 		return nil, fmt.Errorf("failed to auto migrate: %w", err)
 	}
 
+	// 创建设备搜索使用的数据库函数和全文检索索引
+	if err := search.Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate search: %w", err)
+	}
+
+	// 初始化内置角色
+	if err := rbac.Seed(db); err != nil {
+		return nil, fmt.Errorf("failed to seed roles: %w", err)
+	}
+
 	DB = db
 	return db, nil
 }
@@ -43,6 +63,41 @@ func autoMigrate(db *gorm.DB) error {
 		&models.AuthLog{},
 		&models.DeviceHistory{},
 		&models.User{},
+		&models.UserSession{},
+		&models.APIKey{},
+		&models.AuditLog{},
+		&models.Invitation{},
+		&models.RecoveryCode{},
+		&models.Role{},
+		&models.RolePermission{},
+		&models.RolePermissionSeed{},
+		&models.SystemConfig{},
+		&models.UserDomain{},
+		&models.DeviceTypeSchema{},
+		&models.MetadataMigrationFailure{},
+		&models.DeviceTransfer{},
+		&models.DeviceKey{},
+		&models.DeviceChallenge{},
+		&models.TrustPolicy{},
+		&models.TrustRule{},
 	)
 }
 
+
+// NewRedis 初始化 Redis 连接
+func NewRedis(cfg config.RedisConfig) (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return rdb, nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// migrateDeviceMetadata 将设备元数据列从 text 转换为 jsonb
+// 无法解析为 JSON 对象的记录保存到 metadata_migration_failures 并重置为空对象，
+// 列已是 jsonb 或设备表不存在时不做任何操作
+func migrateDeviceMetadata(db *gorm.DB) error {
+	var dataType string
+	err := db.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'devices' AND column_name = 'metadata'`).
+		Scan(&dataType).Error
+	if err != nil {
+		return err
+	}
+	if dataType == "" || dataType == "jsonb" {
+		return nil
+	}
+
+	if err := db.AutoMigrate(&models.MetadataMigrationFailure{}); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		type row struct {
+			DID      string
+			Metadata *string
+		}
+		var rows []row
+		if err := tx.Raw("SELECT d_id AS did, metadata FROM devices").Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, r := range rows {
+			// 空元数据直接视为空对象，不算失败
+			if r.Metadata != nil && *r.Metadata != "" {
+				reason := checkMetadataObject(*r.Metadata)
+				if reason == "" {
+					continue
+				}
+				failure := models.MetadataMigrationFailure{DeviceDID: r.DID, OriginalMetadata: *r.Metadata, Reason: reason}
+				if err := tx.Create(&failure).Error; err != nil {
+					return err
+				}
+				log.Printf("metadata migration: device %s: %s, original saved and reset to {}", r.DID, reason)
+				failed++
+			}
+			if err := tx.Exec("UPDATE devices SET metadata = '{}' WHERE d_id = ?", r.DID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("ALTER TABLE devices ALTER COLUMN metadata TYPE jsonb USING metadata::jsonb").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE devices ALTER COLUMN metadata SET DEFAULT '{}'").Error; err != nil {
+			return err
+		}
+
+		log.Printf("metadata migration: converted %d devices to jsonb, %d failed", len(rows)-failed, failed)
+		return nil
+	})
+}
+
+// checkMetadataObject 检查元数据是否为 JSON 对象，不是时返回原因
+func checkMetadataObject(raw string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return "invalid JSON: " + err.Error()
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return "metadata must be a JSON object"
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+// Package devicekey 设备公钥登记和挑战-应答认证
+//
+// 设备在系统中登记 Ed25519 或 secp256k1 公钥，认证时系统签发一次性挑战（随机 nonce），
+// 设备用私钥对挑战消息签名，系统用登记的公钥验证签名，证明请求确实来自持有私钥的设备。
+//
+// 签名规则：
+//   - Ed25519：对挑战消息直接签名，签名64字节
+//   - secp256k1：对挑战消息的 SHA-256 摘要做 ECDSA 签名，签名为64字节 R||S（S 取低值），
+//     也接受末尾带恢复标识 V 的65字节签名
+package devicekey
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 支持的公钥算法
+const (
+	AlgEd25519   = "Ed25519"
+	AlgSecp256k1 = "secp256k1"
+)
+
+// ErrUnsupportedAlgorithm 不支持的公钥算法
+var ErrUnsupportedAlgorithm = errors.New("Unsupported key algorithm, must be Ed25519 or secp256k1")
+
+// NormalizeAlgorithm 规范化算法名称（不区分大小写）
+func NormalizeAlgorithm(alg string) (string, error) {
+	switch strings.ToLower(alg) {
+	case "ed25519":
+		return AlgEd25519, nil
+	case "secp256k1":
+		return AlgSecp256k1, nil
+	}
+	return "", ErrUnsupportedAlgorithm
+}
+
+// ParsePublicKey 解析公钥（hex 或 base64），返回规范化的 hex 编码
+// secp256k1 公钥可以是33字节压缩格式或65字节非压缩格式，统一保存为压缩格式
+func ParsePublicKey(alg, encoded string) (string, error) {
+	raw, err := DecodeBytes(encoded)
+	if err != nil {
+		return "", fmt.Errorf("public key encoding: %w", err)
+	}
+
+	switch alg {
+	case AlgEd25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("Ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+		}
+		return hex.EncodeToString(raw), nil
+	case AlgSecp256k1:
+		switch len(raw) {
+		case 33:
+			pub, err := crypto.DecompressPubkey(raw)
+			if err != nil {
+				return "", fmt.Errorf("secp256k1 public key: %v", err)
+			}
+			return hex.EncodeToString(crypto.CompressPubkey(pub)), nil
+		case 65:
+			pub, err := crypto.UnmarshalPubkey(raw)
+			if err != nil {
+				return "", fmt.Errorf("secp256k1 public key: %v", err)
+			}
+			return hex.EncodeToString(crypto.CompressPubkey(pub)), nil
+		}
+		return "", fmt.Errorf("secp256k1 public key must be 33 or 65 bytes, got %d", len(raw))
+	}
+	return "", ErrUnsupportedAlgorithm
+}
+
+// VerifySignature 用公钥（规范化的 hex）验证消息签名
+func VerifySignature(alg, publicKey string, message, signature []byte) bool {
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return false
+	}
+
+	switch alg {
+	case AlgEd25519:
+		if len(pub) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize {
+			return false
+		}
+		return ed25519.Verify(ed25519.PublicKey(pub), message, signature)
+	case AlgSecp256k1:
+		if len(signature) == 65 {
+			signature = signature[:64]
+		}
+		if len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(message)
+		return crypto.VerifySignature(pub, digest[:], signature)
+	}
+	return false
+}
+
+// DecodeBytes 解码 hex（可带 0x 前缀）或 base64（标准或 URL 编码，可省略填充）
+func DecodeBytes(encoded string) ([]byte, error) {
+	s := strings.TrimSpace(encoded)
+	if s == "" {
+		return nil, errors.New("empty value")
+	}
+	hexStr := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if b, err := hex.DecodeString(hexStr); err == nil {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("expected hex or base64")
+}
+
+// multicodec 公钥类型前缀（varint 编码）
+var multicodecPrefix = map[string][]byte{
+	AlgEd25519:   {0xed, 0x01},
+	AlgSecp256k1: {0xe7, 0x01},
+}
+
+// Multibase 公钥的 multibase 编码（base58btc，z 开头），用于 DID 文档中的 Multikey 验证方法
+func Multibase(alg, publicKey string) string {
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return ""
+	}
+	prefix, ok := multicodecPrefix[alg]
+	if !ok {
+		return ""
+	}
+	return "z" + base58Encode(append(append([]byte{}, prefix...), pub...))
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Encode(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// 前导零字节编码为 '1'
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
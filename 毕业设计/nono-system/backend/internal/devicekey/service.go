@@ -0,0 +1,266 @@
+package devicekey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// DefaultChallengeTTL 挑战默认有效期
+const DefaultChallengeTTL = 2 * time.Minute
+
+var (
+	// ErrInvalidKey 公钥或公钥标识格式错误
+	ErrInvalidKey = errors.New("Invalid device key")
+	// ErrKeyExists 设备已登记同名或相同的公钥
+	ErrKeyExists = errors.New("Key already registered for this device")
+	// ErrKeyNotFound 公钥不存在或已吊销
+	ErrKeyNotFound = errors.New("Device key not found or revoked")
+	// ErrNoActiveKey 设备没有可用的公钥
+	ErrNoActiveKey = errors.New("Device has no active key")
+	// ErrKeyIDRequired 设备有多个公钥时必须指定 key_id
+	ErrKeyIDRequired = errors.New("key_id is required when the device has more than one active key")
+	// ErrChallengeNotFound 挑战不存在或不属于该设备
+	ErrChallengeNotFound = errors.New("Challenge not found")
+	// ErrChallengeExpired 挑战已过期
+	ErrChallengeExpired = errors.New("Challenge has expired")
+	// ErrChallengeUsed 挑战已被使用
+	ErrChallengeUsed = errors.New("Challenge has already been used")
+	// ErrChallengeAudience 挑战限定的目标域与本次请求不一致
+	ErrChallengeAudience = errors.New("Challenge was issued for a different target domain")
+	// ErrInvalidSignature 签名格式错误或验证失败
+	ErrInvalidSignature = errors.New("Invalid device signature")
+)
+
+// keyIDPattern 公钥标识：字母、数字、点、下划线和连字符
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Proof 设备对挑战的应答
+type Proof struct {
+	Nonce     string `json:"nonce" binding:"required"`
+	KeyID     string `json:"key_id"` // 设备只有一个可用公钥时可省略
+	Signature string `json:"signature" binding:"required"`
+}
+
+// Service 设备公钥和挑战管理
+type Service struct {
+	db           *gorm.DB
+	challengeTTL time.Duration
+}
+
+// NewService 创建设备公钥服务，challengeTTL 为0时使用默认有效期
+func NewService(db *gorm.DB, challengeTTL time.Duration) *Service {
+	if challengeTTL <= 0 {
+		challengeTTL = DefaultChallengeTTL
+	}
+	return &Service{db: db, challengeTTL: challengeTTL}
+}
+
+// ChallengeMessage 设备需要签名的挑战消息
+func ChallengeMessage(did, nonce, audience string) string {
+	return "nono-device-auth\n" + did + "\n" + nonce + "\n" + audience
+}
+
+// Enroll 为设备登记公钥，keyID 为空时自动生成 key-N
+func (s *Service) Enroll(did, keyID, alg, publicKey, createdBy string) (*models.DeviceKey, error) {
+	alg, err := NormalizeAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := ParsePublicKey(alg, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if keyID != "" && !keyIDPattern.MatchString(keyID) {
+		return nil, fmt.Errorf("%w: key_id may only contain letters, digits, '.', '_' and '-' (max 64)", ErrInvalidKey)
+	}
+
+	key := &models.DeviceKey{
+		DeviceDID: did,
+		KeyID:     keyID,
+		Algorithm: alg,
+		PublicKey: normalized,
+		Status:    models.DeviceKeyActive,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var existing []models.DeviceKey
+		if err := tx.Where("device_did = ?", did).Find(&existing).Error; err != nil {
+			return err
+		}
+		for _, k := range existing {
+			if k.KeyID == keyID || (k.Status == models.DeviceKeyActive && k.PublicKey == normalized) {
+				return ErrKeyExists
+			}
+		}
+		if key.KeyID == "" {
+			n := len(existing) + 1
+			for taken(existing, fmt.Sprintf("key-%d", n)) {
+				n++
+			}
+			key.KeyID = fmt.Sprintf("key-%d", n)
+		}
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func taken(keys []models.DeviceKey, keyID string) bool {
+	for _, k := range keys {
+		if k.KeyID == keyID {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys 设备的全部公钥（包括已吊销的）
+func (s *Service) Keys(did string) ([]models.DeviceKey, error) {
+	var keys []models.DeviceKey
+	err := s.db.Where("device_did = ?", did).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// ActiveKeys 设备当前可用的公钥
+func (s *Service) ActiveKeys(did string) ([]models.DeviceKey, error) {
+	var keys []models.DeviceKey
+	err := s.db.Where("device_did = ? AND status = ?", did, models.DeviceKeyActive).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke 吊销设备公钥
+func (s *Service) Revoke(did, keyID string) (*models.DeviceKey, error) {
+	var key models.DeviceKey
+	if err := s.db.Where("device_did = ? AND key_id = ? AND status = ?", did, keyID, models.DeviceKeyActive).
+		First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	now := time.Now()
+	key.Status = models.DeviceKeyRevoked
+	key.RevokedAt = &now
+	if err := s.db.Model(&key).Updates(map[string]interface{}{"status": key.Status, "revoked_at": now}).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// IssueChallenge 为设备签发一次性挑战，audience 不为空时只能用于该目标域的跨域认证
+func (s *Service) IssueChallenge(did, audience, issuedBy string) (*models.DeviceChallenge, error) {
+	keys, err := s.ActiveKeys(did)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoActiveKey
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	challenge := &models.DeviceChallenge{
+		DeviceDID: did,
+		Nonce:     hex.EncodeToString(buf),
+		Audience:  audience,
+		IssuedBy:  issuedBy,
+		ExpiresAt: time.Now().Add(s.challengeTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Create(challenge).Error; err != nil {
+		return nil, err
+	}
+
+	// 顺便清理早已过期的挑战
+	s.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.DeviceChallenge{})
+	return challenge, nil
+}
+
+// Verify 验证设备对挑战的签名，成功后挑战失效，返回签名使用的公钥
+// audience 不为空时要求与挑战限定的目标域一致（挑战未限定时不检查）
+func (s *Service) Verify(did string, proof Proof, audience string) (*models.DeviceKey, error) {
+	var challenge models.DeviceChallenge
+	if err := s.db.Where("nonce = ? AND device_did = ?", proof.Nonce, did).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	if challenge.UsedAt != nil {
+		return nil, ErrChallengeUsed
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrChallengeExpired
+	}
+	if audience != "" && challenge.Audience != "" && challenge.Audience != audience {
+		return nil, ErrChallengeAudience
+	}
+
+	key, err := s.findKey(did, proof.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := DecodeBytes(proof.Signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	message := ChallengeMessage(did, challenge.Nonce, challenge.Audience)
+	if !VerifySignature(key.Algorithm, key.PublicKey, []byte(message), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// 条件更新保证同一挑战只能成功使用一次
+	now := time.Now()
+	result := s.db.Model(&models.DeviceChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Updates(map[string]interface{}{"used_at": now, "key_id": key.KeyID})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrChallengeUsed
+	}
+	s.db.Model(key).Update("last_used_at", now)
+	return key, nil
+}
+
+// findKey 查找可用公钥，未指定 keyID 时设备必须只有一个可用公钥
+func (s *Service) findKey(did, keyID string) (*models.DeviceKey, error) {
+	if keyID != "" {
+		var key models.DeviceKey
+		if err := s.db.Where("device_did = ? AND key_id = ? AND status = ?", did, keyID, models.DeviceKeyActive).
+			First(&key).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrKeyNotFound
+			}
+			return nil, err
+		}
+		return &key, nil
+	}
+
+	keys, err := s.ActiveKeys(did)
+	if err != nil {
+		return nil, err
+	}
+	switch len(keys) {
+	case 0:
+		return nil, ErrNoActiveKey
+	case 1:
+		return &keys[0], nil
+	}
+	return nil, ErrKeyIDRequired
+}
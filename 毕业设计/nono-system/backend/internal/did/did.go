@@ -0,0 +1,86 @@
+// Package did 设备 DID：语法校验、DID 文档生成和解析结果
+//
+// DID 语法遵循 W3C DID Core：
+//
+//	did:<method>:<method-specific-id>
+//
+// method 由小写字母和数字组成；method-specific-id 由冒号分隔的若干段组成，
+// 每段可包含字母、数字、. - _ 和百分号编码（%XX），最后一段不能为空。
+// 本系统的 did:nono 方法进一步要求每一段都不为空，如 did:nono:factory-1:sensor-0001
+package did
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MethodNono 本系统的 DID 方法
+const MethodNono = "nono"
+
+// maxLength DID 的最大长度
+const maxLength = 256
+
+// syntaxPattern DID 语法（不含路径、查询和片段）
+var syntaxPattern = regexp.MustCompile(
+	`^did:([a-z0-9]+):((?:(?:[A-Za-z0-9._-]|%[0-9A-Fa-f]{2})*:)*(?:[A-Za-z0-9._-]|%[0-9A-Fa-f]{2})+)$`)
+
+// DID 解析后的 DID
+type DID struct {
+	Method string
+	ID     string // method-specific-id
+}
+
+// String 返回完整的 DID
+func (d DID) String() string {
+	return "did:" + d.Method + ":" + d.ID
+}
+
+// Error DID 语法错误
+type Error struct {
+	DID    string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid DID %q: %s", e.DID, e.Reason)
+}
+
+// Parse 解析并校验 DID
+func Parse(s string) (DID, error) {
+	if len(s) > maxLength {
+		return DID{}, &Error{DID: s, Reason: fmt.Sprintf("longer than %d characters", maxLength)}
+	}
+	m := syntaxPattern.FindStringSubmatch(s)
+	if m == nil {
+		return DID{}, &Error{DID: s, Reason: "expected did:<method>:<method-specific-id>"}
+	}
+
+	d := DID{Method: m[1], ID: m[2]}
+	if d.Method == MethodNono {
+		for _, segment := range strings.Split(d.ID, ":") {
+			if segment == "" {
+				return DID{}, &Error{DID: s, Reason: "did:nono identifiers must not contain empty segments"}
+			}
+		}
+	}
+	return d, nil
+}
+
+// Validate 校验 DID 语法
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
+// DomainDID 域的 DID，作为域内设备 DID 文档的控制者
+func DomainDID(domain string) string {
+	// 域名可能包含中文等字符，按百分号编码
+	return "did:" + MethodNono + ":domain:" + strings.ReplaceAll(url.PathEscape(domain), ":", "%3A")
+}
+
+// IssuerDID 本系统作为凭证签发者的 DID
+func IssuerDID(issuer string) string {
+	return "did:" + MethodNono + ":issuer:" + strings.ReplaceAll(url.PathEscape(issuer), ":", "%3A")
+}
@@ -0,0 +1,173 @@
+package did
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"nono-system/backend/internal/devicekey"
+	"nono-system/backend/internal/models"
+)
+
+// JSON-LD 上下文
+const (
+	ContextDIDv1      = "https://www.w3.org/ns/did/v1"
+	ContextResolution = "https://w3id.org/did-resolution/v1"
+	ContextMultikey   = "https://w3id.org/security/multikey/v1"
+)
+
+// 解析结果的内容类型
+const (
+	ContentTypeDIDLD      = "application/did+ld+json"
+	ContentTypeResolution = `application/ld+json;profile="https://w3id.org/did-resolution"`
+)
+
+// 解析错误，取值见 W3C DID Resolution
+const (
+	ErrInvalidDID         = "invalidDid"
+	ErrNotFound           = "notFound"
+	ErrMethodNotSupported = "methodNotSupported"
+)
+
+// Document DID 文档
+type Document struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	Controller         string               `json:"controller,omitempty"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+	Authentication     []string             `json:"authentication"`
+	AssertionMethod    []string             `json:"assertionMethod"`
+	Service            []Service            `json:"service"`
+}
+
+// VerificationMethod 验证方法（设备公钥），类型为 Multikey
+type VerificationMethod struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
+// Service 服务端点
+type Service struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// DocumentMetadata DID 文档元数据
+type DocumentMetadata struct {
+	Created     *time.Time `json:"created,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Deactivated bool       `json:"deactivated"`
+	VersionID   string     `json:"versionId,omitempty"`
+}
+
+// ResolutionMetadata 解析过程元数据
+type ResolutionMetadata struct {
+	ContentType string    `json:"contentType,omitempty"`
+	Retrieved   time.Time `json:"retrieved"`
+	Error       string    `json:"error,omitempty"`
+	Message     string    `json:"errorMessage,omitempty"`
+}
+
+// ResolutionResult DID 解析结果
+type ResolutionResult struct {
+	Context            string             `json:"@context"`
+	Document           *Document          `json:"didDocument"`
+	ResolutionMetadata ResolutionMetadata `json:"didResolutionMetadata"`
+	DocumentMetadata   DocumentMetadata   `json:"didDocumentMetadata"`
+}
+
+// NewDocument 为设备生成 DID 文档，baseURL 为本系统对外的地址，用于服务端点
+// 设备所属域的 DID 为文档的控制者，设备可用的公钥作为验证方法
+func NewDocument(device *models.Device, keys []models.DeviceKey, baseURL string) *Document {
+	id := device.DID
+	escaped := url.PathEscape(id)
+	methods := []VerificationMethod{}
+	refs := []string{}
+	for _, key := range keys {
+		if key.Status != models.DeviceKeyActive {
+			continue
+		}
+		methods = append(methods, VerificationMethod{
+			ID:                 id + "#" + key.KeyID,
+			Type:               "Multikey",
+			Controller:         id,
+			PublicKeyMultibase: devicekey.Multibase(key.Algorithm, key.PublicKey),
+		})
+		refs = append(refs, id+"#"+key.KeyID)
+	}
+	return &Document{
+		Context:            []string{ContextDIDv1, ContextMultikey},
+		ID:                 id,
+		Controller:         DomainDID(device.Domain),
+		VerificationMethod: methods,
+		Authentication:     refs,
+		AssertionMethod:    refs,
+		Service: []Service{
+			{ID: id + "#resolver", Type: "DIDResolver", ServiceEndpoint: baseURL + "/api/v1/did/" + escaped},
+			{ID: id + "#device-status", Type: "DeviceStatusService", ServiceEndpoint: baseURL + "/api/v1/devices/" + escaped},
+			{ID: id + "#cross-domain-auth", Type: "CrossDomainAuthService", ServiceEndpoint: baseURL + "/api/v1/auth/cross-domain"},
+		},
+	}
+}
+
+// NewIssuerDocument 凭证签发者的 DID 文档，包含凭证签名公钥（Ed25519）
+func NewIssuerDocument(id, keyID string, publicKey ed25519.PublicKey) *Document {
+	ref := id + "#" + keyID
+	return &Document{
+		Context: []string{ContextDIDv1, ContextMultikey},
+		ID:      id,
+		VerificationMethod: []VerificationMethod{{
+			ID:                 ref,
+			Type:               "Multikey",
+			Controller:         id,
+			PublicKeyMultibase: devicekey.Multibase(devicekey.AlgEd25519, hex.EncodeToString(publicKey)),
+		}},
+		Authentication:  []string{},
+		AssertionMethod: []string{ref},
+		Service:         []Service{},
+	}
+}
+
+// Resolve 生成设备的解析结果，已吊销的设备标记为 deactivated
+// 结果供匿名调用方使用，文档元数据只包含 deactivated，不包含设备状态、版本和时间
+func Resolve(device *models.Device, keys []models.DeviceKey, baseURL string) *ResolutionResult {
+	return &ResolutionResult{
+		Context:  ContextResolution,
+		Document: NewDocument(device, keys, baseURL),
+		ResolutionMetadata: ResolutionMetadata{
+			ContentType: ContentTypeDIDLD,
+			Retrieved:   time.Now().UTC(),
+		},
+		DocumentMetadata: DocumentMetadata{
+			Deactivated: device.Status == "revoked",
+		},
+	}
+}
+
+// ResolveDocument 不对应设备的 DID 文档（如签发者）的解析结果
+func ResolveDocument(doc *Document) *ResolutionResult {
+	return &ResolutionResult{
+		Context:  ContextResolution,
+		Document: doc,
+		ResolutionMetadata: ResolutionMetadata{
+			ContentType: ContentTypeDIDLD,
+			Retrieved:   time.Now().UTC(),
+		},
+	}
+}
+
+// Failure 解析失败的结果
+func Failure(code, message string) *ResolutionResult {
+	return &ResolutionResult{
+		Context: ContextResolution,
+		ResolutionMetadata: ResolutionMetadata{
+			Retrieved: time.Now().UTC(),
+			Error:     code,
+			Message:   message,
+		},
+	}
+}
@@ -0,0 +1,159 @@
+// Package grant 跨域授权（grant）的有效期和撤销
+//
+// 每条授权成功的认证记录（AuthRecord）即为一个授权，在 expires_at 之前有效。
+// 授权可以被显式撤销；设备被吊销、标记为可疑或迁移到其他域时，其全部有效授权自动失效。
+// 没有有效期的历史记录（引入授权有效期之前的记录）不视为有效授权。
+package grant
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// DefaultTTL 授权默认有效期
+const DefaultTTL = time.Hour
+
+// 授权状态
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusRevoked = "revoked"
+)
+
+var (
+	// ErrGrantNotFound 授权不存在（或认证未通过，没有产生授权）
+	ErrGrantNotFound = errors.New("Grant not found")
+	// ErrGrantRevoked 授权已被撤销
+	ErrGrantRevoked = errors.New("Grant has already been revoked")
+)
+
+// Service 授权管理
+type Service struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewService 创建授权服务，ttl 为0时使用默认有效期
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Service{db: db, ttl: ttl}
+}
+
+// TTL 授权默认有效期
+func (s *Service) TTL() time.Duration {
+	return s.ttl
+}
+
+// Status 授权在 now 时的状态
+func Status(record *models.AuthRecord, now time.Time) string {
+	switch {
+	case record.RevokedAt != nil:
+		return StatusRevoked
+	case record.ExpiresAt == nil || !record.ExpiresAt.After(now):
+		return StatusExpired
+	}
+	return StatusActive
+}
+
+// activeScope 在 now 时有效的授权
+func activeScope(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("authorized = ? AND revoked_at IS NULL AND expires_at > ?", true, now)
+}
+
+// List 设备的授权，status 为空或 active 时只返回有效授权，all 返回全部；targetDomain 不为空时只返回该目标域的授权
+func (s *Service) List(did, targetDomain, status string) ([]models.AuthRecord, error) {
+	now := time.Now()
+	query := s.db.Model(&models.AuthRecord{}).Where("device_did = ?", did)
+	switch status {
+	case "", StatusActive:
+		query = activeScope(query, now)
+	case StatusExpired:
+		query = query.Where("authorized = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at <= ?)", true, now)
+	case StatusRevoked:
+		query = query.Where("authorized = ? AND revoked_at IS NOT NULL", true)
+	default:
+		query = query.Where("authorized = ?", true)
+	}
+	if targetDomain != "" {
+		query = query.Where("target_domain = ?", targetDomain)
+	}
+
+	var grants []models.AuthRecord
+	err := query.Order("timestamp DESC, id DESC").Find(&grants).Error
+	return grants, err
+}
+
+// Check 设备当前在目标域中的有效授权（有多个时返回最晚过期的），没有时返回 nil
+func (s *Service) Check(did, targetDomain string) (*models.AuthRecord, error) {
+	var grant models.AuthRecord
+	err := activeScope(s.db, time.Now()).
+		Where("device_did = ? AND target_domain = ?", did, targetDomain).
+		Order("expires_at DESC").
+		First(&grant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// Get 设备的授权
+func (s *Service) Get(did string, id uint) (*models.AuthRecord, error) {
+	var grant models.AuthRecord
+	if err := s.db.Where("id = ? AND device_did = ? AND authorized = ?", id, did, true).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGrantNotFound
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// Revoke 撤销授权
+func (s *Service) Revoke(grant *models.AuthRecord, revokedBy, reason string) error {
+	if grant.RevokedAt != nil {
+		return ErrGrantRevoked
+	}
+	now := time.Now()
+	result := s.db.Model(&models.AuthRecord{}).
+		Where("id = ? AND revoked_at IS NULL", grant.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoked_by": revokedBy, "revoke_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGrantRevoked
+	}
+	grant.RevokedAt = &now
+	grant.RevokedBy = revokedBy
+	grant.RevokeReason = reason
+	return nil
+}
+
+// RevokeAll 撤销设备的全部有效授权，targetDomain 不为空时只撤销该目标域的授权，返回撤销的数量
+func (s *Service) RevokeAll(did, targetDomain, revokedBy, reason string) (int64, error) {
+	query := activeScope(s.db.Model(&models.AuthRecord{}), time.Now()).Where("device_did = ?", did)
+	if targetDomain != "" {
+		query = query.Where("target_domain = ?", targetDomain)
+	}
+	result := query.Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy, "revoke_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeDeviceTx 在调用方的事务中使设备尚未失效的授权全部失效，用于设备吊销、标记可疑和迁移
+// 包括没有有效期的历史授权记录，返回失效的数量
+func RevokeDeviceTx(tx *gorm.DB, did, revokedBy, reason string) (int64, error) {
+	result := tx.Model(&models.AuthRecord{}).
+		Where("device_did = ? AND authorized = ? AND revoked_at IS NULL", did, true).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy, "revoke_reason": reason})
+	return result.RowsAffected, result.Error
+}
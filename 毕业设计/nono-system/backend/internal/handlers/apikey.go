@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/apikey"
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/models"
+)
+
+// CreateAPIKey 创建API密钥（仅管理员）
+func CreateAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name          string   `json:"name" binding:"required"`
+			UserID        uint     `json:"user_id" binding:"required"` // 绑定的用户或预言机账户
+			Scopes        []string `json:"scopes"`                     // 为空表示继承绑定身份的全部权限
+			ExpiresInDays int      `json:"expires_in_days"`            // 0 表示永不过期
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var owner models.User
+		if err := db.Where("id = ? AND is_active = ?", req.UserID, true).First(&owner).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found or inactive"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 密钥的权限范围不能超出绑定身份的角色权限
+		for _, scope := range req.Scopes {
+			if !owner.HasPermission(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Scope not permitted for key owner",
+					"scope": scope,
+					"role":  owner.Role,
+				})
+				return
+			}
+		}
+
+		plaintext, prefix, hash, err := apikey.Generate()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		key := models.APIKey{
+			Name:      req.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			UserID:    owner.ID,
+			Scopes:    strings.Join(req.Scopes, ","),
+			CreatedBy: currentUsername(c),
+		}
+		if req.ExpiresInDays > 0 {
+			expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			key.ExpiresAt = &expiresAt
+		}
+
+		if err := db.Create(&key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "api_key.create", fmt.Sprintf("api_key:%d", key.ID), true,
+			fmt.Sprintf("name=%s owner=%s scopes=%s", key.Name, owner.Username, key.Scopes))
+
+		// 明文密钥只返回这一次
+		c.JSON(http.StatusCreated, gin.H{
+			"api_key": key,
+			"key":     plaintext,
+		})
+	}
+}
+
+// ListAPIKeys 列出API密钥（仅管理员）
+func ListAPIKeys(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var keys []models.APIKey
+		query := db.Model(&models.APIKey{})
+
+		if userID := c.Query("user_id"); userID != "" {
+			query = query.Where("user_id = ?", userID)
+		}
+		if c.Query("include_revoked") != "true" {
+			query = query.Where("revoked_at IS NULL")
+		}
+
+		if err := query.Order("created_at DESC").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// RotateAPIKey 轮换API密钥，旧密钥立即失效（仅管理员）
+func RotateAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := findAPIKey(c, db)
+		if !ok {
+			return
+		}
+		if key.RevokedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "API key already revoked"})
+			return
+		}
+
+		plaintext, prefix, hash, err := apikey.Generate()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		oldPrefix := key.Prefix
+		key.Prefix = prefix
+		key.KeyHash = hash
+		if err := db.Save(key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "api_key.rotate", fmt.Sprintf("api_key:%d", key.ID), true,
+			fmt.Sprintf("old_prefix=%s new_prefix=%s", oldPrefix, prefix))
+
+		c.JSON(http.StatusOK, gin.H{
+			"api_key": key,
+			"key":     plaintext,
+		})
+	}
+}
+
+// RevokeAPIKey 吊销API密钥（仅管理员）
+func RevokeAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := findAPIKey(c, db)
+		if !ok {
+			return
+		}
+		if key.RevokedAt != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "API key already revoked"})
+			return
+		}
+
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := db.Save(key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "api_key.revoke", fmt.Sprintf("api_key:%d", key.ID), true, "name="+key.Name)
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+	}
+}
+
+// findAPIKey 按路径参数 id 查找API密钥，未找到时直接写入响应
+func findAPIKey(c *gin.Context, db *gorm.DB) (*models.APIKey, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return nil, false
+	}
+
+	var key models.APIKey
+	if err := db.First(&key, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &key, true
+}
+
+// currentUsername 获取当前认证用户的用户名
+func currentUsername(c *gin.Context) string {
+	if user, exists := c.Get("user"); exists {
+		return user.(*models.User).Username
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// ListAuditLogs 查询审计日志
+// 支持按操作者、操作类型、资源、结果和时间范围过滤，按时间倒序分页返回
+func ListAuditLogs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := auditLogQuery(c, db, 0)
+		if !ok {
+			return
+		}
+
+		if actor := c.Query("actor"); actor != "" {
+			query = query.Where("actor = ?", actor)
+		}
+		if action := c.Query("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+		// 按操作类型前缀过滤，如 action_prefix=user. 匹配全部用户管理操作
+		if prefix := c.Query("action_prefix"); prefix != "" {
+			query = query.Where("action LIKE ?", escapeLike(prefix)+"%")
+		}
+		if resource := c.Query("resource"); resource != "" {
+			query = query.Where("resource = ?", resource)
+		}
+		if success := c.Query("success"); success != "" {
+			b, err := strconv.ParseBool(success)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid success filter"})
+				return
+			}
+			query = query.Where("success = ?", b)
+		}
+
+		page, err := parsePageParams(c, 50)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var logs []models.AuditLog
+		if err := page.apply(query.Order("created_at DESC, id DESC")).Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		hasMore := len(logs) > page.PageSize
+		if hasMore {
+			logs = logs[:page.PageSize]
+		}
+
+		c.JSON(http.StatusOK, pageResult("logs", logs, total, page, hasMore))
+	}
+}
+
+// GetAuditStats 审计日志统计：按结果、操作类型、操作者和日期汇总
+// 未指定时间范围时统计最近7天
+func GetAuditStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		base, ok := auditLogQuery(c, db, 7*24*time.Hour)
+		if !ok {
+			return
+		}
+
+		var total, failed int64
+		base.Session(&gorm.Session{}).Count(&total)
+		base.Session(&gorm.Session{}).Where("success = ?", false).Count(&failed)
+
+		type actionCount struct {
+			Action string `json:"action"`
+			Total  int64  `json:"total"`
+			Failed int64  `json:"failed"`
+		}
+		var byAction []actionCount
+		if err := base.Session(&gorm.Session{}).
+			Select("action, COUNT(*) AS total, SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failed").
+			Group("action").Order("total DESC").
+			Scan(&byAction).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		type actorCount struct {
+			Actor string `json:"actor"`
+			Total int64  `json:"total"`
+		}
+		var topActors []actorCount
+		if err := base.Session(&gorm.Session{}).
+			Select("actor, COUNT(*) AS total").
+			Where("actor <> ''").
+			Group("actor").Order("total DESC").Limit(10).
+			Scan(&topActors).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		type dayCount struct {
+			Day    time.Time `json:"day"`
+			Total  int64     `json:"total"`
+			Failed int64     `json:"failed"`
+		}
+		var byDay []dayCount
+		if err := base.Session(&gorm.Session{}).
+			Select("date_trunc('day', created_at) AS day, COUNT(*) AS total, SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failed").
+			Group("day").Order("day").
+			Scan(&byDay).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 失败登录次数单独列出，便于发现暴力破解
+		var failedLogins int64
+		base.Session(&gorm.Session{}).Where("action = ? AND success = ?", "user.login", false).Count(&failedLogins)
+
+		c.JSON(http.StatusOK, gin.H{
+			"total":         total,
+			"success":       total - failed,
+			"failed":        failed,
+			"success_rate":  calculateRate(total-failed, total),
+			"failed_logins": failedLogins,
+			"by_action":     byAction,
+			"top_actors":    topActors,
+			"by_day":        byDay,
+		})
+	}
+}
+
+// auditLogQuery 构造审计日志查询并应用时间范围（from/to，RFC3339 格式）
+// 均未指定且 defaultWindow 大于0时，只查询最近 defaultWindow 内的日志
+func auditLogQuery(c *gin.Context, db *gorm.DB, defaultWindow time.Duration) (*gorm.DB, bool) {
+	query := db.Model(&models.AuditLog{})
+
+	if c.Query("from") == "" && c.Query("to") == "" && defaultWindow > 0 {
+		return query.Where("created_at >= ?", time.Now().Add(-defaultWindow)), true
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC3339"})
+			return nil, false
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC3339"})
+			return nil, false
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	return query, true
+}
@@ -9,22 +9,39 @@ import (
 	"gorm.io/gorm"
 
 	"nono-system/backend/internal/blockchain"
+	"nono-system/backend/internal/devicekey"
+	"nono-system/backend/internal/grant"
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/trust"
+	"nono-system/backend/pkg/vc"
 )
 
 // RequestCrossDomainAuth 请求跨域认证
-func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.HandlerFunc {
+// 请求可附带 device_proof（设备对认证挑战的签名），附带时必须验证通过；
+// requireSignature 为 true 时所有请求都必须附带。
+// 目标域配置了信任策略时，被策略拒绝的请求不上链，记录为未授权，认证记录中保存匹配的规则。
+// 授权成功时产生一个有有效期的授权（grant），并签发可验证凭证，目标域可离线验证；
+// 凭证有效期为 credentialTTL，且不超过授权有效期
+func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client, keys *devicekey.Service, requireSignature bool,
+	policies *trust.Service, grants *grant.Service, issuer *vc.Issuer, credentialTTL time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			DeviceDID    string `json:"device_did" binding:"required"`
-			SourceDomain string `json:"source_domain" binding:"required"`
-			TargetDomain string `json:"target_domain" binding:"required"`
+			DeviceDID    string           `json:"device_did" binding:"required"`
+			SourceDomain string           `json:"source_domain" binding:"required"`
+			TargetDomain string           `json:"target_domain" binding:"required"`
+			DeviceProof  *devicekey.Proof `json:"device_proof"`
+			TTLMinutes   int              `json:"ttl_minutes"` // 申请的授权有效期（分钟），不能超过系统默认值
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if req.TTLMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_minutes must not be negative"})
+			return
+		}
 
 		// 查询设备
 		var device models.Device
@@ -37,15 +54,10 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 			return
 		}
 
-		// 检查设备访问权限
-		user, exists := c.Get("user")
-		if exists {
-			u := user.(*models.User)
-			// 操作人员只能发起自己域设备的跨域认证
-			if u.Role == models.RoleOperator && u.Domain != device.Domain {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Cannot request cross-domain auth for devices in other domains"})
-				return
-			}
+		// 操作人员等域级权限的角色只能为在该域中具有认证权限的设备发起跨域认证
+		if !middleware.CheckDomainPermission(c, device.Domain, models.PermAuthRequest) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot request cross-domain auth for devices in other domains"})
+			return
 		}
 
 		// 检查设备状态
@@ -80,12 +92,46 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 			return
 		}
 
+		// 验证设备签名，证明请求来自持有私钥的设备
+		var deviceKeyID string
+		if req.DeviceProof == nil && requireSignature {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Device signature required, request a challenge first"})
+			return
+		}
+		if req.DeviceProof != nil {
+			key, err := keys.Verify(req.DeviceDID, *req.DeviceProof, req.TargetDomain)
+			if err != nil {
+				db.Create(&models.AuthLog{
+					DeviceDID:    req.DeviceDID,
+					SourceDomain: req.SourceDomain,
+					TargetDomain: req.TargetDomain,
+					Action:       "failed",
+					Message:      "Device signature verification failed: " + err.Error(),
+					IPAddress:    c.ClientIP(),
+					UserAgent:    c.GetHeader("User-Agent"),
+				})
+				respondDeviceProofError(c, err)
+				return
+			}
+			deviceKeyID = key.KeyID
+		}
+
+		// 评估目标域的信任策略
+		decision, err := policies.Decide(req.TargetDomain, &device, req.SourceDomain, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		// 调用区块链合约进行跨域认证
 		var txHash string
 		var authorized bool
-		var err error
 
-		if bcClient != nil && bcClient.IsConnected() {
+		if !decision.Allowed {
+			// 信任策略拒绝，不再上链
+			log.Printf("Cross-domain auth denied by trust policy of %s: %s", req.TargetDomain, decision.Reason)
+			authorized = false
+		} else if bcClient != nil && bcClient.IsConnected() {
 			// 调用区块链合约
 			txHash, authorized, err = bcClient.RequestCrossDomainAuth(
 				req.DeviceDID,
@@ -107,6 +153,20 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 			txHash = ""
 		}
 
+		// 授权有效期：系统默认值，不超过申请的时长和信任规则限定的最长时间
+		grantTTL := grants.TTL()
+		if requested := time.Duration(req.TTLMinutes) * time.Minute; requested > 0 && requested < grantTTL {
+			grantTTL = requested
+		}
+		if decision.MaxSession > 0 && decision.MaxSession < grantTTL {
+			grantTTL = decision.MaxSession
+		}
+		var expiresAt *time.Time
+		if authorized {
+			t := time.Now().Add(grantTTL)
+			expiresAt = &t
+		}
+
 		// 记录认证记录
 		authRecord := models.AuthRecord{
 			DeviceDID:    req.DeviceDID,
@@ -114,6 +174,12 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 			TargetDomain: req.TargetDomain,
 			Authorized:   authorized,
 			TxHash:       txHash,
+			DeviceKeyID:  deviceKeyID,
+			TrustPolicyID: decision.PolicyID,
+			TrustRuleID:  decision.RuleID,
+			TrustRule:    decision.RuleName,
+			TrustDecision: decision.Source,
+			ExpiresAt:    expiresAt,
 			Timestamp:    time.Now(),
 		}
 
@@ -129,6 +195,9 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 		}
 
 		message := "Cross-domain authentication"
+		if !decision.Allowed {
+			message += " denied by trust policy: " + decision.Reason
+		}
 		if txHash != "" {
 			message += " (txHash: " + txHash + ")"
 		}
@@ -151,12 +220,37 @@ func RequestCrossDomainAuth(db *gorm.DB, bcClient *blockchain.Client) gin.Handle
 		if txHash != "" {
 			response["tx_hash"] = txHash
 		}
+		if deviceKeyID != "" {
+			response["device_key_id"] = deviceKeyID
+		}
+		if decision.Source != trust.SourceNoPolicy {
+			response["trust_decision"] = decision
+		}
+		if expiresAt != nil {
+			response["expires_at"] = expiresAt
+		}
+		if authorized && issuer != nil {
+			// 凭证有效期不超过授权有效期
+			ttl := credentialTTL
+			if grantTTL < ttl {
+				ttl = grantTTL
+			}
+			credential, cred, err := issueAuthCredential(db, issuer, ttl, &authRecord)
+			if err != nil {
+				log.Printf("Failed to issue credential for auth record %d: %v", authRecord.ID, err)
+			} else {
+				response["credential"] = credential
+				response["credential_id"] = cred.ID
+				response["credential_expires_at"] = cred.ExpirationDate
+			}
+		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
 // SyncAuthRecord 同步前端上链的认证记录到数据库
+// 同步的记录只作为认证日志，没有有效期，不产生跨域授权
 func SyncAuthRecord(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
@@ -184,6 +278,11 @@ func SyncAuthRecord(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !middleware.CheckDomainPermission(c, device.Domain, models.PermAuthRequest) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot sync auth records for devices in other domains"})
+			return
+		}
+
 		// 验证设备的域是否与源域匹配
 		if device.Domain != req.SourceDomain {
 			c.JSON(http.StatusForbidden, gin.H{
@@ -294,10 +393,13 @@ func SyncAuthRecord(db *gorm.DB) gin.HandlerFunc {
 // GetAuthRecords 获取认证记录
 func GetAuthRecords(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		did := c.Param("did")
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
 
 		var records []models.AuthRecord
-		if err := db.Where("device_did = ?", did).Order("timestamp DESC").Find(&records).Error; err != nil {
+		if err := db.Where("device_did = ?", device.DID).Order("timestamp DESC").Find(&records).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -312,22 +414,39 @@ func GetAuthLogs(db *gorm.DB) gin.HandlerFunc {
 		did := c.Query("device_did")
 		domain := c.Query("domain")
 
-		var logs []models.AuthLog
-		query := db.Model(&models.AuthLog{})
+		page, err := parsePageParams(c, 100)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query := middleware.ApplyAuthFilter(c, db.Model(&models.AuthLog{}), "auth_logs")
 
 		if did != "" {
 			query = query.Where("device_did = ?", did)
 		}
 		if domain != "" {
-			query = query.Where("source_domain = ? OR target_domain = ?", domain, domain)
+			query = query.Where("(source_domain = ? OR target_domain = ?)", domain, domain)
 		}
 
-		if err := query.Order("created_at DESC").Limit(100).Find(&logs).Error; err != nil {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, logs)
+		var logs []models.AuthLog
+		if err := page.apply(query.Order("created_at DESC, id DESC")).Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		hasMore := len(logs) > page.PageSize
+		if hasMore {
+			logs = logs[:page.PageSize]
+		}
+
+		c.JSON(http.StatusOK, pageResult("logs", logs, total, page, hasMore))
 	}
 }
 
@@ -1,18 +1,23 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/did"
+	"nono-system/backend/internal/metadata"
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/registry"
 )
 
 // BatchRegisterDevices 批量注册设备
-func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
+// 每个设备的 DID 和元数据单独校验，不合法的设备注册失败，不影响其他设备
+func BatchRegisterDevices(db *gorm.DB, validator *metadata.Validator, devices *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			Devices []struct {
@@ -24,6 +29,8 @@ func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
 				Firmware    string `json:"firmware"`
 				Domain      string `json:"domain" binding:"required"`
 				Metadata    string `json:"metadata"`
+				Owner       string `json:"owner"`
+				IsPublic    bool   `json:"is_public"`
 			} `json:"devices" binding:"required"`
 		}
 
@@ -47,6 +54,44 @@ func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
 		var failCount int
 
 		for _, deviceReq := range req.Devices {
+			if err := did.Validate(deviceReq.DID); err != nil {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   err.Error(),
+				})
+				failCount++
+				continue
+			}
+
+			if !middleware.CheckDomainPermission(c, deviceReq.Domain, models.PermDeviceRegister) &&
+				!middleware.CheckDomainPermission(c, deviceReq.Domain, models.PermDeviceRegisterDomain) {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   "Insufficient permissions in this domain",
+				})
+				failCount++
+				continue
+			}
+
+			meta, err := validator.Validate(deviceReq.DeviceType, deviceReq.Metadata)
+			if err != nil {
+				result := gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   err.Error(),
+				}
+				var ve *metadata.ValidationError
+				if errors.As(err, &ve) {
+					result["error"] = ve.Message
+					result["details"] = ve.Details
+				}
+				results = append(results, result)
+				failCount++
+				continue
+			}
+
 			device := models.Device{
 				DID:          deviceReq.DID,
 				DeviceID:    deviceReq.DeviceID,
@@ -56,12 +101,14 @@ func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
 				Firmware:    deviceReq.Firmware,
 				Domain:      deviceReq.Domain,
 				Status:      "active",
-				Metadata:    deviceReq.Metadata,
+				Metadata:    meta,
+				Owner:       deviceReq.Owner,
+				IsPublic:    deviceReq.IsPublic,
 				RegisteredAt: time.Now(),
 				LastUpdated:  time.Now(),
 			}
 
-			if err := db.Create(&device).Error; err != nil {
+			if _, err := devices.Register(deviceActor(c), &device, "批量注册设备", ""); err != nil {
 				results = append(results, gin.H{
 					"did":     deviceReq.DID,
 					"success": false,
@@ -69,11 +116,6 @@ func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
 				})
 				failCount++
 			} else {
-				// 记录历史
-				oldValue, _ := json.Marshal(nil)
-				newValue, _ := json.Marshal(device)
-				_ = RecordDeviceHistory(db, device.DID, "register", string(oldValue), string(newValue), "system", "", "批量注册设备")
-				
 				results = append(results, gin.H{
 					"did":     deviceReq.DID,
 					"success": true,
@@ -93,7 +135,7 @@ func BatchRegisterDevices(db *gorm.DB) gin.HandlerFunc {
 }
 
 // BatchUpdateDeviceStatus 批量更新设备状态
-func BatchUpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
+func BatchUpdateDeviceStatus(db *gorm.DB, devices *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			Devices []struct {
@@ -128,11 +170,55 @@ func BatchUpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
 				continue
 			}
 
-			oldStatus := device.Status
-			device.Status = deviceReq.Status
-			device.LastUpdated = time.Now()
+			if !validDeviceStatus(deviceReq.Status) {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   "Invalid status",
+				})
+				failCount++
+				continue
+			}
 
-			if err := db.Save(&device).Error; err != nil {
+			// 预言机节点等域级角色只能更新自己域的设备
+			if !middleware.CheckDeviceAccess(c, &device) {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   "Access denied to this domain",
+				})
+				failCount++
+				continue
+			}
+			if !middleware.CheckDomainPermission(c, device.Domain, models.PermDeviceUpdate) &&
+				!middleware.CheckDomainPermission(c, device.Domain, models.PermDeviceStatusUpdate) {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   "Insufficient permissions in this domain",
+				})
+				failCount++
+				continue
+			}
+			if deviceReq.Status == "revoked" && !middleware.CheckDomainPermission(c, device.Domain, models.PermDeviceRevoke) {
+				results = append(results, gin.H{
+					"did":     deviceReq.DID,
+					"success": false,
+					"error":   "Revoking a device requires device:revoke permission",
+				})
+				failCount++
+				continue
+			}
+
+			change := registry.Change{
+				Action:      "status_change",
+				Description: "批量更新状态",
+				Updates:     map[string]interface{}{"status": deviceReq.Status},
+			}
+			if deviceReq.Status == "revoked" {
+				change.Action = "revoke"
+			}
+			if _, err := devices.Update(deviceActor(c), &device, change); err != nil {
 				results = append(results, gin.H{
 					"did":     deviceReq.DID,
 					"success": false,
@@ -140,11 +226,6 @@ func BatchUpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
 				})
 				failCount++
 			} else {
-				// 记录历史
-				oldValue, _ := json.Marshal(gin.H{"status": oldStatus})
-				newValue, _ := json.Marshal(gin.H{"status": deviceReq.Status})
-				_ = RecordDeviceHistory(db, device.DID, "status_change", string(oldValue), string(newValue), "system", "", "批量更新状态")
-				
 				results = append(results, gin.H{
 					"did":     deviceReq.DID,
 					"success": true,
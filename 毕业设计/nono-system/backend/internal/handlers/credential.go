@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+	"nono-system/backend/pkg/vc"
+)
+
+// issueAuthCredential 为授权成功的跨域认证记录签发凭证，并在记录中保存凭证ID和过期时间
+func issueAuthCredential(db *gorm.DB, issuer *vc.Issuer, ttl time.Duration, record *models.AuthRecord) (string, *vc.Credential, error) {
+	token, cred, err := issuer.Issue(vc.Subject{
+		ID:           record.DeviceDID,
+		SourceDomain: record.SourceDomain,
+		TargetDomain: record.TargetDomain,
+		Authorized:   record.Authorized,
+		TxHash:       record.TxHash,
+		RecordID:     record.ID,
+		DeviceKeyID:  record.DeviceKeyID,
+	}, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	expiresAt := cred.ExpirationDate
+	record.CredentialID = cred.ID
+	record.CredentialExpiresAt = &expiresAt
+	if err := db.Model(record).Updates(map[string]interface{}{
+		"credential_id":         cred.ID,
+		"credential_expires_at": expiresAt,
+	}).Error; err != nil {
+		return "", nil, err
+	}
+	return token, cred, nil
+}
+
+// GetCredentialIssuer 凭证签发者信息和签名公钥（JWK），供目标域离线验证凭证
+func GetCredentialIssuer(issuer *vc.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kid := issuer.ID() + "#" + vc.KeyID
+		c.JSON(http.StatusOK, gin.H{
+			"issuer": issuer.ID(),
+			"key_id": kid,
+			"jwk":    vc.NewJWK(issuer.PublicKey(), kid),
+		})
+	}
+}
+
+// VerifyCredential 验证跨域认证凭证
+// 除签名、有效期和目标域（audience）外，还检查授权是否已撤销或过期、设备当前是否仍处于 active 状态。
+// 验证结果在 valid 中返回，凭证无效时 reason 为原因
+func VerifyCredential(db *gorm.DB, issuer *vc.Issuer) gin.HandlerFunc {
+	verifier := vc.NewVerifier(issuer.ID(), issuer.PublicKey())
+	return func(c *gin.Context) {
+		var req struct {
+			Credential string `json:"credential" binding:"required"`
+			Audience   string `json:"audience"` // 验证方所在的目标域
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cred, err := verifier.Verify(req.Credential, vc.VerifyOptions{Audience: req.Audience})
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"valid": false, "reason": err.Error()})
+			return
+		}
+
+		invalid := func(reason string) {
+			c.JSON(http.StatusOK, gin.H{"valid": false, "reason": reason, "credential": cred})
+		}
+
+		var record models.AuthRecord
+		if err := db.Where("credential_id = ?", cred.ID).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				invalid("credential not issued by this system")
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if record.RevokedAt != nil {
+			invalid("authorization revoked: " + record.RevokeReason)
+			return
+		}
+		if record.ExpiresAt != nil && !record.ExpiresAt.After(time.Now()) {
+			invalid("authorization expired")
+			return
+		}
+
+		var device models.Device
+		if err := db.Where("d_id = ?", cred.CredentialSubject.ID).First(&device).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				invalid("device not found")
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if device.Status != "active" {
+			invalid("device is " + device.Status)
+			return
+		}
+		if device.Domain != cred.CredentialSubject.SourceDomain {
+			invalid("device no longer belongs to the source domain")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"valid":         true,
+			"credential":    cred,
+			"record_id":     record.ID,
+			"device_status": device.Status,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/middleware"
+	"nono-system/backend/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// recordingDB 只生成SQL、不连接数据库的会话，执行的每条查询都记录在返回的切片中
+func recordingDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := &[]string{}
+	record := func(tx *gorm.DB) {
+		*statements = append(*statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	return db, statements
+}
+
+// TestOperatorCannotSeeOtherDomains 域A的操作人员查询统计和导出时，设备、认证记录和域的每条查询都限定在域A，
+// 查询参数指定域B时也不能越过
+func TestOperatorCannotSeeOtherDomains(t *testing.T) {
+	operator := &models.User{ID: 7, Username: "op-a", Role: models.RoleOperator, Domain: "domain-a"}
+
+	scoped := map[string]string{
+		`FROM "devices"`:      `devices.domain IN ('domain-a')`,
+		`FROM "auth_records"`: `(auth_records.source_domain IN ('domain-a') OR auth_records.target_domain IN ('domain-a'))`,
+		`FROM "domains"`:      `domains.name IN ('domain-a')`,
+	}
+
+	tests := []struct {
+		name    string
+		handler func(db *gorm.DB) gin.HandlerFunc
+		target  string
+		tables  []string // 必须查询到的表
+	}{
+		{"statistics", GetStatistics, "/statistics", []string{`FROM "devices"`, `FROM "auth_records"`, `FROM "domains"`}},
+		{"export devices", ExportDevices, "/export/devices", []string{`FROM "devices"`}},
+		{"export devices of another domain", ExportDevices, "/export/devices?domain=domain-b", []string{`FROM "devices"`}},
+		{"export auth records", ExportAuthRecords, "/export/auth-records", []string{`FROM "auth_records"`}},
+		{"export auth records of another domain's device", ExportAuthRecords, "/export/auth-records?device_did=did:nono:device:b1", []string{`FROM "auth_records"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := recordingDB(t)
+
+			router := gin.New()
+			router.GET(strings.SplitN(tt.target, "?", 2)[0],
+				func(c *gin.Context) { c.Set("user", operator) },
+				middleware.FilterByDataPermission(db),
+				tt.handler(db))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			seen := make(map[string]bool)
+			for _, stmt := range *statements {
+				for table, filter := range scoped {
+					if !strings.Contains(stmt, table) {
+						continue
+					}
+					seen[table] = true
+					if !strings.Contains(stmt, filter) {
+						t.Errorf("query is not limited to domain-a:\n %s", stmt)
+					}
+				}
+			}
+			for _, table := range tt.tables {
+				if !seen[table] {
+					t.Errorf("no query %s was executed", table)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/did"
+	"nono-system/backend/internal/metadata"
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/registry"
 )
 
 // RegisterDevice 注册设备
-func RegisterDevice(db *gorm.DB) gin.HandlerFunc {
+// DID 必须符合 did:<method>:<method-specific-id> 语法；元数据必须是 JSON 对象，设备类型注册了 Schema 时还必须符合该 Schema
+func RegisterDevice(db *gorm.DB, validator *metadata.Validator, devices *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			DID         string `json:"did" binding:"required"`
@@ -23,6 +32,8 @@ func RegisterDevice(db *gorm.DB) gin.HandlerFunc {
 			Firmware    string `json:"firmware"`
 			Domain      string `json:"domain" binding:"required"`
 			Metadata    string `json:"metadata"`
+			Owner       string `json:"owner"`     // 设备所有者用户名
+			IsPublic    bool   `json:"is_public"` // 是否对所有用户公开
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -30,6 +41,20 @@ func RegisterDevice(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if err := did.Validate(req.DID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !requireDomainPermission(c, req.Domain, models.PermDeviceRegister, models.PermDeviceRegisterDomain) {
+			return
+		}
+
+		meta, ok := validateMetadata(c, validator, req.DeviceType, req.Metadata)
+		if !ok {
+			return
+		}
+
 		device := models.Device{
 			DID:         req.DID,
 			DeviceID:    req.DeviceID,
@@ -39,12 +64,14 @@ func RegisterDevice(db *gorm.DB) gin.HandlerFunc {
 			Firmware:    req.Firmware,
 			Domain:      req.Domain,
 			Status:      "active",
-			Metadata:    req.Metadata,
+			Metadata:    meta,
+			Owner:       req.Owner,
+			IsPublic:    req.IsPublic,
 			RegisteredAt: time.Now(),
 			LastUpdated:  time.Now(),
 		}
 
-		if err := db.Create(&device).Error; err != nil {
+		if _, err := devices.Register(deviceActor(c), &device, "注册设备", ""); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -55,32 +82,22 @@ func RegisterDevice(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetDevice 获取设备信息
+// GetDevice 获取设备信息，ETag 为设备当前版本，修改设备时放入 If-Match
 func GetDevice(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 获取 DID 参数，Gin 会自动解码 URL 编码
-		did := c.Param("did")
-
-		var device models.Device
-		if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
 			return
 		}
 
+		c.Header("ETag", deviceETag(device.Version))
 		c.JSON(http.StatusOK, device)
 	}
 }
 
 // UpdateDeviceStatus 更新设备状态
-func UpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
+func UpdateDeviceStatus(db *gorm.DB, devices *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 获取 DID 参数，Gin 会自动解码 URL 编码
-		did := c.Param("did")
-
 		var req struct {
 			Status string `json:"status" binding:"required"`
 		}
@@ -90,21 +107,35 @@ func UpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var device models.Device
-		if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if !validDeviceStatus(req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, must be one of active, suspicious, revoked"})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceUpdate, models.PermDeviceStatusUpdate) {
 			return
 		}
 
-		device.Status = req.Status
-		device.LastUpdated = time.Now()
+		// 只有状态更新权限（预言机）时不能吊销设备
+		if req.Status == "revoked" && !middleware.CheckDomainPermission(c, device.Domain, models.PermDeviceRevoke) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Revoking a device requires device:revoke permission"})
+			return
+		}
 
-		if err := db.Save(&device).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		change := registry.Change{
+			Action:      "status_change",
+			Description: "更新设备状态",
+			Updates:     map[string]interface{}{"status": req.Status},
+		}
+		if req.Status == "revoked" {
+			change.Action, change.Description = "revoke", "吊销设备"
+		}
+		if _, err := devices.Update(deviceActor(c), device, change); err != nil {
+			respondDeviceUpdateError(c, err)
 			return
 		}
 
@@ -114,8 +145,196 @@ func UpdateDeviceStatus(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// UpdateDeviceVisibility 修改设备的公开状态和所有者
+func UpdateDeviceVisibility(db *gorm.DB, devices *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			IsPublic *bool   `json:"is_public"`
+			Owner    *string `json:"owner"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceUpdate) {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.IsPublic != nil {
+			updates["is_public"] = *req.IsPublic
+		}
+		if req.Owner != nil {
+			// 所有者必须是已存在的用户
+			if *req.Owner != "" {
+				var count int64
+				db.Model(&models.User{}).Where("username = ?", *req.Owner).Count(&count)
+				if count == 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Owner user not found"})
+					return
+				}
+			}
+			updates["owner"] = *req.Owner
+		}
+		if len(updates) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+
+		change := registry.Change{Action: "update", Description: "修改设备可见性", Updates: updates}
+		if _, err := devices.Update(deviceActor(c), device, change); err != nil {
+			respondDeviceUpdateError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, device)
+	}
+}
+
+// ReportDeviceStatus 预言机上报设备状态
+// 预言机只能将设备标记为正常或可疑，吊销须由有吊销权限的用户操作；已吊销的设备不接受上报
+func ReportDeviceStatus(db *gorm.DB, devices *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Status     string     `json:"status" binding:"required"`
+			Source     string     `json:"source"`      // 数据源名称
+			Reason     string     `json:"reason"`      // 状态判断依据
+			ObservedAt *time.Time `json:"observed_at"` // 数据源观测时间，默认当前时间
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Status != "active" && req.Status != "suspicious" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, oracle may only report active or suspicious"})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		// 预言机节点只能上报在该域中具有上报权限的设备
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceStatusReport) {
+			return
+		}
+
+		if device.Status == "revoked" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Device is revoked"})
+			return
+		}
+
+		observedAt := time.Now()
+		if req.ObservedAt != nil && !req.ObservedAt.IsZero() && req.ObservedAt.Before(observedAt) {
+			observedAt = *req.ObservedAt
+		}
+
+		oldStatus := device.Status
+		changed := oldStatus != req.Status
+
+		// 状态变化时记录历史，未变化的上报只刷新最后更新时间，不修改版本号，避免使其他客户端的 ETag 失效
+		if changed {
+			actor := deviceActor(c)
+			if actor.Username == "" {
+				actor.Username = "oracle"
+			}
+			change := registry.Change{
+				Action:      "status_change",
+				Description: strings.TrimSpace(fmt.Sprintf("预言机上报 %s %s", req.Source, req.Reason)),
+				Updates:     map[string]interface{}{"status": req.Status, "last_updated": observedAt},
+			}
+			if _, err := devices.Update(actor, device, change); err != nil {
+				respondDeviceUpdateError(c, err)
+				return
+			}
+		} else if err := devices.Touch(device, observedAt); err != nil {
+			respondDeviceUpdateError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"did":        device.DID,
+			"status":     device.Status,
+			"changed":    changed,
+			"old_status": oldStatus,
+		})
+	}
+}
+
+// loadAccessibleDevice 按路径参数 did 加载设备并检查当前用户的对象级访问权限
+// 设备不存在返回404，无权访问返回403并记录拒绝日志，两种情况都直接写入响应
+func loadAccessibleDevice(c *gin.Context, db *gorm.DB) (*models.Device, bool) {
+	// Gin 会自动解码 URL 编码的 DID
+	did := c.Param("did")
+
+	var device models.Device
+	if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found", "did": did})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "did": did})
+		return nil, false
+	}
+
+	if !middleware.CheckDeviceAccess(c, &device) {
+		log.Printf("Device access denied: user=%s role=%s domain=%s device=%s device_domain=%s route=%s %s",
+			currentUsername(c), c.GetString("user_role"), c.GetString("user_domain"),
+			device.DID, device.Domain, c.Request.Method, c.FullPath())
+		audit.Record(db, c, "device.access_denied", "device:"+device.DID, false,
+			fmt.Sprintf("%s %s device_domain=%s", c.Request.Method, c.FullPath(), device.Domain))
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this device"})
+		return nil, false
+	}
+
+	return &device, true
+}
+
+// requireDomainPermission 检查当前用户在指定域中是否具有任一权限，没有时直接写入403响应
+// 用户在所属域中使用自己的角色，在成员域中使用成员关系指定的角色
+func requireDomainPermission(c *gin.Context, domain string, permissions ...string) bool {
+	for _, permission := range permissions {
+		if middleware.CheckDomainPermission(c, domain, permission) {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":    "Insufficient permissions in this domain",
+		"domain":   domain,
+		"required": permissions,
+	})
+	return false
+}
+
+// deviceActor 当前请求的操作者和客户端IP，写入设备历史
+func deviceActor(c *gin.Context) registry.Actor {
+	return registry.Actor{Username: currentUsername(c), ClientIP: c.ClientIP()}
+}
+
+// respondDeviceUpdateError 设备修改失败时写入响应：并发修改返回409，客户端应重新读取后重试
+func respondDeviceUpdateError(c *gin.Context, err error) {
+	if errors.Is(err, registry.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// validDeviceStatus 检查设备状态取值是否合法
+func validDeviceStatus(status string) bool {
+	return status == "active" || status == "suspicious" || status == "revoked"
+}
+
 // RevokeDevice 吊销设备
-func RevokeDevice(db *gorm.DB) gin.HandlerFunc {
+func RevokeDevice(db *gorm.DB, devices *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取 DID 参数，Gin 会自动解码 URL 编码
 		did := c.Param("did")
@@ -123,34 +342,24 @@ func RevokeDevice(db *gorm.DB) gin.HandlerFunc {
 		// 添加日志用于调试
 		log.Printf("RevokeDevice: received DID = %s", did)
 
-		var device models.Device
-		if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
-			log.Printf("RevokeDevice: database query error for DID %s: %v", did, err)
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{
-					"error": "Device not found",
-					"did":   did,
-				})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-				"did":   did,
-			})
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceRevoke) {
 			return
 		}
 
 		log.Printf("RevokeDevice: found device ID=%d, DID=%s, Status=%s", device.ID, device.DID, device.Status)
 
-		device.Status = "revoked"
-		device.LastUpdated = time.Now()
-
-		if err := db.Save(&device).Error; err != nil {
+		change := registry.Change{
+			Action:      "revoke",
+			Description: "吊销设备",
+			Updates:     map[string]interface{}{"status": "revoked"},
+		}
+		if _, err := devices.Update(deviceActor(c), device, change); err != nil {
 			log.Printf("RevokeDevice: save error for DID %s: %v", did, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-				"did":   did,
-			})
+			respondDeviceUpdateError(c, err)
 			return
 		}
 
@@ -162,30 +371,20 @@ func RevokeDevice(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// ListDevices 列出设备（带权限过滤）
+// ListDevices 列出设备（带权限过滤，分页和排序参数同 SearchDevices）
 func ListDevices(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		domain := c.Query("domain")
 		status := c.Query("status")
 
-		var devices []models.Device
 		query := db.Model(&models.Device{})
 
 		// 应用数据权限过滤
-		permissionType, exists := c.Get("data_permission")
-		if exists {
-			pt := permissionType.(string)
-			if pt == "domain" {
-				userDomain, exists := c.Get("user_domain")
-				if exists && userDomain.(string) != "" {
-					query = query.Where("domain = ?", userDomain.(string))
-				}
-			}
-		}
+		query = middleware.ApplyDeviceFilter(c, query, "devices")
 
 		if domain != "" {
 			// 检查域访问权限
-			if !CheckDomainAccess(c, domain) {
+			if !checkDomainQuery(c, domain) {
 				c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this domain"})
 				return
 			}
@@ -195,12 +394,7 @@ func ListDevices(db *gorm.DB) gin.HandlerFunc {
 			query = query.Where("status = ?", status)
 		}
 
-		if err := query.Find(&devices).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.JSON(http.StatusOK, devices)
+		respondDevicePage(c, query)
 	}
 }
 
@@ -214,6 +408,15 @@ func CheckDomainAccess(c *gin.Context, domain string) bool {
 	return u.CanAccessDomain(domain)
 }
 
+// checkDomainQuery 检查按域过滤的查询参数
+// 受限只读权限的结果已按设备可见性过滤（可包含其他域的公开设备），不额外限制
+func checkDomainQuery(c *gin.Context, domain string) bool {
+	if c.GetString("data_permission") == models.DataScopeRestricted {
+		return true
+	}
+	return CheckDomainAccess(c, domain)
+}
+
 // GetDeviceStatuses 获取设备状态列表（供预言机使用）
 // 返回格式：[]DeviceStatus
 func GetDeviceStatuses(db *gorm.DB) gin.HandlerFunc {
@@ -222,20 +425,11 @@ func GetDeviceStatuses(db *gorm.DB) gin.HandlerFunc {
 		query := db.Model(&models.Device{})
 
 		// 应用数据权限过滤
-		permissionType, exists := c.Get("data_permission")
-		if exists {
-			pt := permissionType.(string)
-			if pt == "domain" {
-				userDomain, exists := c.Get("user_domain")
-				if exists && userDomain.(string) != "" {
-					query = query.Where("domain = ?", userDomain.(string))
-				}
-			}
-		}
+		query = middleware.ApplyDeviceFilter(c, query, "devices")
 
 		// 支持按域和状态过滤
 		if domain := c.Query("domain"); domain != "" {
-			if !CheckDomainAccess(c, domain) {
+			if !checkDomainQuery(c, domain) {
 				c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this domain"})
 				return
 			}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/devicekey"
+	"nono-system/backend/internal/models"
+)
+
+// ListDeviceKeys 列出设备登记的公钥（包括已吊销的）
+func ListDeviceKeys(db *gorm.DB, keys *devicekey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+
+		items, err := keys.Keys(device.DID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"device_did": device.DID, "keys": items})
+	}
+}
+
+// AddDeviceKey 为设备登记公钥
+// 公钥为 hex 或 base64 编码，Ed25519 为32字节，secp256k1 为33字节压缩或65字节非压缩格式
+func AddDeviceKey(db *gorm.DB, keys *devicekey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			KeyID     string `json:"key_id"`
+			Algorithm string `json:"algorithm" binding:"required"`
+			PublicKey string `json:"public_key" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceUpdate) {
+			return
+		}
+		if device.Status == "revoked" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Device has been revoked"})
+			return
+		}
+
+		key, err := keys.Enroll(device.DID, req.KeyID, req.Algorithm, req.PublicKey, currentUsername(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, devicekey.ErrInvalidKey), errors.Is(err, devicekey.ErrUnsupportedAlgorithm):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, devicekey.ErrKeyExists):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		audit.Record(db, c, "device.key_add", "device:"+device.DID, true,
+			fmt.Sprintf("key_id=%s algorithm=%s", key.KeyID, key.Algorithm))
+
+		c.JSON(http.StatusCreated, key)
+	}
+}
+
+// RevokeDeviceKey 吊销设备公钥，吊销后不能再用于签名验证，也不再出现在 DID 文档中
+func RevokeDeviceKey(db *gorm.DB, keys *devicekey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceUpdate) {
+			return
+		}
+
+		key, err := keys.Revoke(device.DID, c.Param("key_id"))
+		if err != nil {
+			if errors.Is(err, devicekey.ErrKeyNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "device.key_revoke", "device:"+device.DID, true, "key_id="+key.KeyID)
+
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+// IssueDeviceChallenge 为设备签发一次性认证挑战
+// 请求体可带 target_domain，此时挑战只能用于向该目标域发起的跨域认证。
+// 设备需对返回的 message 签名，签名在 expires_at 之前通过跨域认证或验证接口提交
+func IssueDeviceChallenge(db *gorm.DB, keys *devicekey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			TargetDomain string `json:"target_domain"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermAuthRequest) {
+			return
+		}
+		if device.Status == "revoked" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Device has been revoked"})
+			return
+		}
+
+		challenge, err := keys.IssueChallenge(device.DID, req.TargetDomain, currentUsername(c))
+		if err != nil {
+			if errors.Is(err, devicekey.ErrNoActiveKey) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"device_did":    device.DID,
+			"nonce":         challenge.Nonce,
+			"target_domain": challenge.Audience,
+			"message":       devicekey.ChallengeMessage(device.DID, challenge.Nonce, challenge.Audience),
+			"expires_at":    challenge.ExpiresAt,
+		})
+	}
+}
+
+// VerifyDeviceChallenge 验证设备对挑战的签名，验证成功后挑战失效
+func VerifyDeviceChallenge(db *gorm.DB, keys *devicekey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var proof devicekey.Proof
+		if err := c.ShouldBindJSON(&proof); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermAuthRequest) {
+			return
+		}
+
+		key, err := keys.Verify(device.DID, proof, "")
+		if err != nil {
+			audit.Record(db, c, "device.challenge_verify", "device:"+device.DID, false, err.Error())
+			respondDeviceProofError(c, err)
+			return
+		}
+
+		audit.Record(db, c, "device.challenge_verify", "device:"+device.DID, true, "key_id="+key.KeyID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"verified":   true,
+			"device_did": device.DID,
+			"key_id":     key.KeyID,
+			"algorithm":  key.Algorithm,
+		})
+	}
+}
+
+// respondDeviceProofError 设备签名验证失败时写入响应
+func respondDeviceProofError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, devicekey.ErrKeyIDRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, devicekey.ErrChallengeNotFound),
+		errors.Is(err, devicekey.ErrChallengeExpired),
+		errors.Is(err, devicekey.ErrChallengeUsed),
+		errors.Is(err, devicekey.ErrChallengeAudience),
+		errors.Is(err, devicekey.ErrKeyNotFound),
+		errors.Is(err, devicekey.ErrNoActiveKey),
+		errors.Is(err, devicekey.ErrInvalidSignature):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Device signature verification failed", "reason": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/metadata"
+	"nono-system/backend/internal/models"
+)
+
+// deviceTypePattern 设备类型名：字母或数字开头，可包含字母、数字、点、下划线和连字符
+var deviceTypePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// maxNonconformingReport Schema 更新后最多列出的不符合新 Schema 的设备数
+const maxNonconformingReport = 100
+
+// deviceTypeSchemaView 设备类型 Schema 的响应格式，Schema 以 JSON 对象返回
+type deviceTypeSchemaView struct {
+	models.DeviceTypeSchema
+	Schema json.RawMessage `json:"schema"`
+}
+
+func newDeviceTypeSchemaView(s models.DeviceTypeSchema) deviceTypeSchemaView {
+	return deviceTypeSchemaView{DeviceTypeSchema: s, Schema: json.RawMessage(s.Schema)}
+}
+
+// ListDeviceTypeSchemas 列出已注册元数据 Schema 的设备类型
+func ListDeviceTypeSchemas(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var schemas []models.DeviceTypeSchema
+		if err := db.Order("device_type").Find(&schemas).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		views := make([]deviceTypeSchemaView, 0, len(schemas))
+		for _, s := range schemas {
+			views = append(views, newDeviceTypeSchemaView(s))
+		}
+		c.JSON(http.StatusOK, views)
+	}
+}
+
+// GetDeviceTypeSchema 获取设备类型的元数据 Schema
+func GetDeviceTypeSchema(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var schema models.DeviceTypeSchema
+		if err := db.Where("device_type = ?", c.Param("type")).First(&schema).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No schema registered for this device type"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newDeviceTypeSchemaView(schema))
+	}
+}
+
+// PutDeviceTypeSchema 注册或替换设备类型的元数据 Schema（JSON Schema 2020-12）
+// 已有设备不会被修改，响应中列出不符合新 Schema 的设备，这些设备下次修改元数据时必须符合新 Schema
+func PutDeviceTypeSchema(db *gorm.DB, validator *metadata.Validator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Schema      json.RawMessage `json:"schema" binding:"required"`
+			Description string          `json:"description"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		deviceType := c.Param("type")
+		if !deviceTypePattern.MatchString(deviceType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device type"})
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, req.Schema); err != nil || buf.Len() == 0 || buf.Bytes()[0] != '{' {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "schema must be a JSON object"})
+			return
+		}
+		compiled, err := metadata.Compile(buf.String())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON Schema", "details": []string{err.Error()}})
+			return
+		}
+
+		var schema models.DeviceTypeSchema
+		err = db.Where("device_type = ?", deviceType).First(&schema).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		created := errors.Is(err, gorm.ErrRecordNotFound)
+
+		schema.DeviceType = deviceType
+		schema.Schema = buf.String()
+		schema.Description = req.Description
+		schema.UpdatedBy = currentUsername(c)
+		if err := db.Save(&schema).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		validator.Invalidate(deviceType)
+
+		action := "device_type_schema.update"
+		status := http.StatusOK
+		if created {
+			action = "device_type_schema.create"
+			status = http.StatusCreated
+		}
+		audit.Record(db, c, action, "device_type:"+deviceType, true, "")
+
+		nonconforming, total, err := findNonconformingDevices(db, deviceType, compiled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(status, gin.H{
+			"schema":              newDeviceTypeSchemaView(schema),
+			"nonconforming":       nonconforming,
+			"nonconforming_total": total,
+		})
+	}
+}
+
+// DeleteDeviceTypeSchema 删除设备类型的元数据 Schema，之后该类型的元数据只要求是 JSON 对象
+func DeleteDeviceTypeSchema(db *gorm.DB, validator *metadata.Validator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceType := c.Param("type")
+		result := db.Where("device_type = ?", deviceType).Delete(&models.DeviceTypeSchema{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No schema registered for this device type"})
+			return
+		}
+		validator.Invalidate(deviceType)
+
+		audit.Record(db, c, "device_type_schema.delete", "device_type:"+deviceType, true, "")
+		c.JSON(http.StatusOK, gin.H{"message": "Schema deleted"})
+	}
+}
+
+// findNonconformingDevices 找出该类型中元数据不符合 Schema 的设备，最多返回 maxNonconformingReport 条明细
+func findNonconformingDevices(db *gorm.DB, deviceType string, schema *jsonschema.Schema) ([]gin.H, int, error) {
+	var rows []struct {
+		DID      string
+		Metadata string
+	}
+	nonconforming := []gin.H{}
+	total := 0
+	err := db.Model(&models.Device{}).
+		Select("d_id AS did, metadata").
+		Where("device_type = ?", deviceType).
+		Order("id").
+		FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+			for _, r := range rows {
+				_, doc, err := metadata.Parse(r.Metadata)
+				if err == nil {
+					err = metadata.Check(schema, doc)
+				}
+				if err != nil {
+					total++
+					if len(nonconforming) < maxNonconformingReport {
+						nonconforming = append(nonconforming, gin.H{"did": r.DID, "error": err.Error()})
+					}
+				}
+			}
+			return nil
+		}).Error
+	return nonconforming, total, err
+}
+
+// validateMetadata 校验设备元数据并返回规范化后的 JSON，不合法时直接写入400响应
+func validateMetadata(c *gin.Context, validator *metadata.Validator, deviceType, raw string) (string, bool) {
+	normalized, err := validator.Validate(deviceType, raw)
+	if err != nil {
+		var ve *metadata.ValidationError
+		if errors.As(err, &ve) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ve.Message, "details": ve.Details})
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return normalized, true
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/metadata"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/registry"
+)
+
+// immutableDeviceFields 不能通过 PATCH 修改的字段及应使用的接口
+var immutableDeviceFields = map[string]string{
+	"did":       "DID cannot be changed",
+	"device_id": "device_id cannot be changed",
+	"domain":    "domain cannot be changed here, use POST /devices/:did/transfers",
+	"status":    "status cannot be changed here, use PUT /devices/:did/status",
+}
+
+// readOnlyDeviceFields 由系统维护的字段，请求中出现时忽略，便于客户端回传完整的设备对象
+var readOnlyDeviceFields = map[string]bool{
+	"id":            true,
+	"registered_at": true,
+	"last_updated":  true,
+	"created_at":    true,
+	"updated_at":    true,
+}
+
+// deviceETag 设备版本对应的 ETag
+func deviceETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch 解析 If-Match 请求头中的设备版本，支持弱校验形式 W/"3"
+func parseIfMatch(header string) (int64, error) {
+	tag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, validationError("Invalid If-Match header, expected a device ETag such as \"3\"")
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, validationError("Invalid If-Match header, expected a device ETag such as \"3\"")
+	}
+	return version, nil
+}
+
+// UpdateDevice 修改设备的可变字段：device_type、manufacturer、model、firmware、owner、is_public、metadata
+// 必须通过 If-Match 请求头（GET 返回的 ETag）或请求体中的 version 指定修改基于的版本，
+// 版本不一致时返回 412，避免多个操作人员同时修改时互相覆盖
+func UpdateDevice(db *gorm.DB, validator *metadata.Validator, devices *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+			return
+		}
+
+		var req struct {
+			DeviceType   *string `json:"device_type"`
+			Manufacturer *string `json:"manufacturer"`
+			Model        *string `json:"model"`
+			Firmware     *string `json:"firmware"`
+			Owner        *string `json:"owner"`
+			IsPublic     *bool   `json:"is_public"`
+			Metadata     *string `json:"metadata"`
+			Version      *int64  `json:"version"`
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceUpdate) {
+			return
+		}
+
+		// 不可变字段只允许回传原值
+		current := map[string]string{
+			"did":       device.DID,
+			"device_id": device.DeviceID,
+			"domain":    device.Domain,
+			"status":    device.Status,
+		}
+		known := map[string]bool{"device_type": true, "manufacturer": true, "model": true, "firmware": true,
+			"owner": true, "is_public": true, "metadata": true, "version": true}
+		keys := make([]string, 0, len(raw))
+		for key := range raw {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if msg, ok := immutableDeviceFields[key]; ok {
+				var v string
+				if err := json.Unmarshal(raw[key], &v); err != nil || v != current[key] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": msg, "field": key})
+					return
+				}
+				continue
+			}
+			if !known[key] && !readOnlyDeviceFields[key] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown field: " + key, "field": key})
+				return
+			}
+		}
+
+		// 版本检查：If-Match 优先，其次是请求体中的 version
+		var expected int64
+		if header := c.GetHeader("If-Match"); header != "" {
+			v, err := parseIfMatch(header)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			expected = v
+		} else if req.Version != nil {
+			expected = *req.Version
+		} else {
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header or version is required"})
+			return
+		}
+		if expected != device.Version {
+			respondVersionConflict(c, device)
+			return
+		}
+
+		updates := map[string]interface{}{}
+		setString := func(column string, value *string, old string) {
+			if value != nil && *value != old {
+				updates[column] = *value
+			}
+		}
+		setString("device_type", req.DeviceType, device.DeviceType)
+		setString("manufacturer", req.Manufacturer, device.Manufacturer)
+		setString("model", req.Model, device.Model)
+		setString("firmware", req.Firmware, device.Firmware)
+
+		if req.Owner != nil && *req.Owner != device.Owner {
+			// 所有者必须是已存在的用户
+			if *req.Owner != "" {
+				var count int64
+				db.Model(&models.User{}).Where("username = ?", *req.Owner).Count(&count)
+				if count == 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Owner user not found"})
+					return
+				}
+			}
+			setString("owner", req.Owner, device.Owner)
+		}
+		if req.IsPublic != nil && *req.IsPublic != device.IsPublic {
+			updates["is_public"] = *req.IsPublic
+		}
+
+		// 修改元数据或设备类型时，按新的设备类型校验元数据
+		if req.Metadata != nil || req.DeviceType != nil {
+			deviceType, meta := device.DeviceType, device.Metadata
+			if req.DeviceType != nil {
+				deviceType = *req.DeviceType
+			}
+			if req.Metadata != nil {
+				meta = *req.Metadata
+			}
+			normalized, ok := validateMetadata(c, validator, deviceType, meta)
+			if !ok {
+				return
+			}
+			if !jsonEqual(normalized, device.Metadata) {
+				updates["metadata"] = normalized
+			}
+		}
+
+		// 没有实际变化时不增加版本
+		if len(updates) == 0 {
+			c.Header("ETag", deviceETag(device.Version))
+			c.JSON(http.StatusOK, device)
+			return
+		}
+
+		change := registry.Change{
+			Action:          "update",
+			Description:     fmt.Sprintf("修改设备信息（版本 %d）", expected),
+			Updates:         updates,
+			ExpectedVersion: expected,
+		}
+		if _, err := devices.Update(deviceActor(c), device, change); err != nil {
+			if errors.Is(err, registry.ErrVersionConflict) {
+				var latest models.Device
+				if db.First(&latest, device.ID).Error == nil {
+					device = &latest
+				}
+				respondVersionConflict(c, device)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", deviceETag(device.Version))
+		c.JSON(http.StatusOK, device)
+	}
+}
+
+// respondVersionConflict 返回412和设备的当前版本，客户端应重新读取后再修改
+func respondVersionConflict(c *gin.Context, device *models.Device) {
+	c.Header("ETag", deviceETag(device.Version))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":           registry.ErrVersionConflict.Error(),
+		"current_version": device.Version,
+	})
+}
+
+// jsonEqual 比较两个 JSON 文本的内容是否相同，忽略键的顺序和空白
+func jsonEqual(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
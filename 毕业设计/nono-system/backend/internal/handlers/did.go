@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/did"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/pkg/vc"
+)
+
+// ResolveDID 解析 DID，返回 W3C DID Resolution 格式的结果
+// 无需登录，因此只解析公开设备（is_public），非公开设备与未注册的 DID 返回相同的结果，不暴露设备是否存在；
+// DID 文档只包含控制者、公钥和服务端点。已吊销设备的文档标记为 deactivated 并返回 410；
+// Accept 为 application/did+ld+json 时只返回 DID 文档。
+// 凭证签发者的 DID 解析为包含凭证签名公钥的文档
+func ResolveDID(db *gorm.DB, publicURL string, issuer *vc.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Gin 会自动解码 URL 编码的 DID
+		raw := c.Param("did")
+
+		id, err := did.Parse(raw)
+		if err != nil {
+			writeResolution(c, http.StatusBadRequest, did.Failure(did.ErrInvalidDID, err.Error()))
+			return
+		}
+
+		if issuer != nil && id.String() == issuer.ID() {
+			writeDocument(c, http.StatusOK, did.ResolveDocument(did.NewIssuerDocument(issuer.ID(), vc.KeyID, issuer.PublicKey())))
+			return
+		}
+
+		var device models.Device
+		if err := db.Where("d_id = ? AND is_public = ?", id.String(), true).First(&device).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			// 其他方法的 DID 只能解析在本系统注册（且公开）的
+			if id.Method != did.MethodNono {
+				writeResolution(c, http.StatusNotImplemented,
+					did.Failure(did.ErrMethodNotSupported, "DID method "+id.Method+" is not supported"))
+				return
+			}
+			writeResolution(c, http.StatusNotFound, did.Failure(did.ErrNotFound, "DID not found"))
+			return
+		}
+
+		var keys []models.DeviceKey
+		if err := db.Where("device_did = ? AND status = ?", device.DID, models.DeviceKeyActive).
+			Order("id").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := did.Resolve(&device, keys, publicBaseURL(c, publicURL))
+		status := http.StatusOK
+		if result.DocumentMetadata.Deactivated {
+			status = http.StatusGone
+		}
+
+		writeDocument(c, status, result)
+	}
+}
+
+// writeDocument 写入解析成功的结果，客户端只请求 DID 文档时只返回文档
+func writeDocument(c *gin.Context, status int, result *did.ResolutionResult) {
+	if acceptsDocumentOnly(c) {
+		body, _ := json.Marshal(result.Document)
+		c.Data(status, did.ContentTypeDIDLD, body)
+		return
+	}
+	writeResolution(c, status, result)
+}
+
+func writeResolution(c *gin.Context, status int, result *did.ResolutionResult) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(status, did.ContentTypeResolution, body)
+}
+
+// acceptsDocumentOnly 客户端只请求 DID 文档（而不是完整的解析结果）
+func acceptsDocumentOnly(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, did.ContentTypeDIDLD) && !strings.Contains(accept, "did-resolution")
+}
+
+// publicBaseURL 本系统对外的地址，未配置时根据请求推断
+func publicBaseURL(c *gin.Context, configured string) string {
+	if configured != "" {
+		return strings.TrimRight(configured, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
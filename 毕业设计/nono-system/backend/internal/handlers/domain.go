@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/trust"
 )
 
 // CreateDomain 创建域
@@ -126,7 +127,17 @@ func DeleteDomain(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&domain).Error; err != nil {
+		// 删除域时一并删除该域的成员关系和信任策略
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("domain = ?", domain.Name).Delete(&models.UserDomain{}).Error; err != nil {
+				return err
+			}
+			if _, err := trust.DeleteTx(tx, domain.Name); err != nil {
+				return err
+			}
+			return tx.Delete(&domain).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
 )
 
@@ -17,8 +18,8 @@ func ExportDevices(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var devices []models.Device
 		
-		// 支持过滤条件
-		query := db.Model(&models.Device{})
+		// 支持过滤条件（在数据权限范围内）
+		query := middleware.ApplyDeviceFilter(c, db.Model(&models.Device{}), "devices")
 		
 		if domain := c.Query("domain"); domain != "" {
 			query = query.Where("domain = ?", domain)
@@ -75,7 +76,7 @@ func ExportAuthRecords(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var records []models.AuthRecord
 		
-		query := db.Model(&models.AuthRecord{})
+		query := middleware.ApplyAuthFilter(c, db.Model(&models.AuthRecord{}), "auth_records")
 		
 		if did := c.Query("device_did"); did != "" {
 			query = query.Where("device_did = ?", did)
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/grant"
+	"nono-system/backend/internal/middleware"
+	"nono-system/backend/internal/models"
+)
+
+// grantView 授权及其当前状态
+type grantView struct {
+	models.AuthRecord
+	Status string `json:"status"`
+}
+
+func newGrantViews(records []models.AuthRecord, now time.Time) []grantView {
+	views := make([]grantView, 0, len(records))
+	for i := range records {
+		views = append(views, grantView{AuthRecord: records[i], Status: grant.Status(&records[i], now)})
+	}
+	return views
+}
+
+// ListAuthGrants 列出设备的跨域授权
+// 默认只返回有效授权；status 可为 active、expired、revoked 或 all，target_domain 按目标域过滤
+func ListAuthGrants(db *gorm.DB, grants *grant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.Query("status")
+		switch status {
+		case "", grant.StatusActive, grant.StatusExpired, grant.StatusRevoked, "all":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, must be one of active, expired, revoked, all"})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+
+		records, err := grants.List(device.DID, c.Query("target_domain"), status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"device_did": device.DID,
+			"grants":     newGrantViews(records, time.Now()),
+			"total":      len(records),
+		})
+	}
+}
+
+// CheckAuthGrant 目标域校验设备当前是否持有有效授权
+// target_domain 必填；调用方需能访问该目标域或该设备。设备不处于 active 状态时视为未授权。
+// 不能访问该设备的调用方无法区分设备不存在、设备状态异常和没有授权，避免借此探测其他域的设备
+func CheckAuthGrant(db *gorm.DB, grants *grant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		did := c.Param("did")
+		targetDomain := c.Query("target_domain")
+		if targetDomain == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target_domain is required"})
+			return
+		}
+
+		var device models.Device
+		err := db.Where("d_id = ?", did).First(&device).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "did": did})
+			return
+		}
+		exists := err == nil
+		deviceAccess := exists && middleware.CheckDeviceAccess(c, &device)
+		if !deviceAccess && !middleware.CheckDomainAccess(c, targetDomain) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this device or target domain"})
+			return
+		}
+
+		response := gin.H{
+			"device_did":    did,
+			"target_domain": targetDomain,
+			"authorized":    false,
+			"reason":        "no active grant",
+		}
+		if !exists {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		if device.Status != "active" {
+			if deviceAccess {
+				response["reason"] = "device is " + device.Status
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		g, err := grants.Check(device.DID, targetDomain)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if g == nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		delete(response, "reason")
+		response["authorized"] = true
+		response["grant"] = grantView{AuthRecord: *g, Status: grant.StatusActive}
+		response["expires_at"] = g.ExpiresAt
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// RevokeAuthGrant 撤销一个跨域授权，需要在设备所属域或授权的目标域中具有发起认证的权限
+// 请求体可带 reason 说明撤销原因
+func RevokeAuthGrant(db *gorm.DB, grants *grant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grant ID"})
+			return
+		}
+		reason, ok := bindRevokeReason(c)
+		if !ok {
+			return
+		}
+
+		device, ok := findGrantDevice(c, db)
+		if !ok {
+			return
+		}
+
+		g, err := grants.Get(device.DID, uint(id))
+		if err != nil {
+			if errors.Is(err, grant.ErrGrantNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !middleware.CheckDomainPermission(c, device.Domain, models.PermAuthRequest) &&
+			!middleware.CheckDomainPermission(c, g.TargetDomain, models.PermAuthRequest) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":    "Insufficient permissions in the device or target domain",
+				"required": []string{models.PermAuthRequest},
+			})
+			return
+		}
+
+		if err := grants.Revoke(g, currentUsername(c), reason); err != nil {
+			if errors.Is(err, grant.ErrGrantRevoked) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "auth.grant_revoke", "device:"+device.DID, true,
+			fmt.Sprintf("grant=%d target_domain=%s reason=%s", g.ID, g.TargetDomain, reason))
+
+		c.JSON(http.StatusOK, grantView{AuthRecord: *g, Status: grant.StatusRevoked})
+	}
+}
+
+// RevokeAuthGrants 撤销设备的全部有效授权，target_domain 不为空时只撤销该目标域的授权
+// 不指定目标域时需要在设备所属域中具有发起认证的权限，指定时也可以是目标域中的权限
+func RevokeAuthGrants(db *gorm.DB, grants *grant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reason, ok := bindRevokeReason(c)
+		if !ok {
+			return
+		}
+
+		device, ok := findGrantDevice(c, db)
+		if !ok {
+			return
+		}
+
+		targetDomain := c.Query("target_domain")
+		if targetDomain == "" || !middleware.CheckDomainPermission(c, targetDomain, models.PermAuthRequest) {
+			if !requireDomainPermission(c, device.Domain, models.PermAuthRequest) {
+				return
+			}
+		}
+
+		revoked, err := grants.RevokeAll(device.DID, targetDomain, currentUsername(c), reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "auth.grant_revoke_all", "device:"+device.DID, true,
+			fmt.Sprintf("target_domain=%s revoked=%d reason=%s", targetDomain, revoked, reason))
+
+		c.JSON(http.StatusOK, gin.H{
+			"device_did":    device.DID,
+			"target_domain": targetDomain,
+			"revoked":       revoked,
+		})
+	}
+}
+
+// findGrantDevice 按路径参数 did 查找设备，不检查设备访问权限（目标域也可以校验和撤销授权）
+func findGrantDevice(c *gin.Context, db *gorm.DB) (*models.Device, bool) {
+	did := c.Param("did")
+
+	var device models.Device
+	if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found", "did": did})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "did": did})
+		return nil, false
+	}
+	return &device, true
+}
+
+// bindRevokeReason 读取可选请求体中的撤销原因
+func bindRevokeReason(c *gin.Context) (string, bool) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return "", false
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "revoked manually"
+	}
+	return req.Reason, true
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,67 +16,243 @@ import (
 )
 
 // GetDeviceHistory 获取设备操作历史
+// 支持按操作类型（action，可逗号分隔多个）、操作者（actor）和时间范围（from/to，RFC3339）过滤，
+// diff=true 时每条记录附带字段级差异
 func GetDeviceHistory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		did := c.Param("did")
-		
-		// 验证设备存在
-		var device models.Device
-		if err := db.Where("d_id = ?", did).First(&device).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		// 验证设备存在且有权访问
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		did := device.DID
+
+		// 支持分页
+		page, err := parsePageParams(c, defaultPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		withDiff := false
+		if v := c.Query("diff"); v != "" {
+			withDiff, err = strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid diff, must be true or false"})
 				return
 			}
+		}
+
+		// 查询历史记录
+		query := db.Model(&models.DeviceHistory{}).Where("device_did = ?", did)
+
+		if action := c.Query("action"); action != "" {
+			query = query.Where("action IN ?", strings.Split(action, ","))
+		}
+		if actor := c.Query("actor"); actor != "" {
+			query = query.Where("changed_by = ?", actor)
+		}
+		if from := c.Query("from"); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC3339"})
+				return
+			}
+			query = query.Where("created_at >= ?", t)
+		}
+		if to := c.Query("to"); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC3339"})
+				return
+			}
+			query = query.Where("created_at < ?", t)
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		// 查询历史记录
-		var history []models.DeviceHistory
-		query := db.Where("device_did = ?", did)
-		
-		// 支持分页
-		page := c.DefaultQuery("page", "1")
-		pageSize := c.DefaultQuery("page_size", "20")
-		
-		var pageNum, size int
-		pageNum = 1
-		size = 20
-		
-		// 简化处理，实际应该解析为整数
-		if page != "1" {
-			// 可以添加解析逻辑
-		}
-		if pageSize != "20" {
-			// 可以添加解析逻辑
-		}
-		
 		// 按时间倒序
-		if err := query.Order("created_at DESC").Limit(size).Offset((pageNum - 1) * size).Find(&history).Error; err != nil {
+		var history []models.DeviceHistory
+		if err := page.apply(query.Order("created_at DESC, id DESC")).Find(&history).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		hasMore := len(history) > page.PageSize
+		if hasMore {
+			history = history[:page.PageSize]
+		}
+
+		var items interface{} = history
+		if withDiff {
+			entries := make([]historyEntry, 0, len(history))
+			for _, h := range history {
+				entries = append(entries, historyEntry{DeviceHistory: h, Diff: diffHistoryValues(h.OldValue, h.NewValue)})
+			}
+			items = entries
+		}
+
+		resp := pageResult("history", items, total, page, hasMore)
+		resp["device_did"] = did
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// GetDeviceStateAt 还原设备在指定时间（at，RFC3339）的状态
+// 从设备的当前状态出发，按时间倒序依次撤销该时间之后的历史记录（应用 old_value）。
+// 版本号和更新时间无法还原，不包含在结果中
+func GetDeviceStateAt(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+
+		at, err := time.Parse(time.RFC3339, c.Query("at"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing at, expected RFC3339"})
+			return
+		}
+
+		if at.Before(device.RegisteredAt) && at.Before(device.CreatedAt) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device was not registered at this time", "did": device.DID})
+			return
+		}
+
+		var later []models.DeviceHistory
+		if err := db.Where("device_did = ? AND created_at > ?", device.DID, at).
+			Order("created_at DESC, id DESC").
+			Find(&later).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		data, _ := json.Marshal(device)
+		state := make(map[string]json.RawMessage)
+		_ = json.Unmarshal(data, &state)
+
+		for _, h := range later {
+			// 注册记录之前设备还不存在
+			if h.Action == "register" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Device was not registered at this time", "did": device.DID})
+				return
+			}
+			var old map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(h.OldValue), &old); err != nil {
+				continue
+			}
+			for field, value := range old {
+				state[field] = value
+			}
+		}
+
+		for _, field := range []string{"version", "last_updated", "updated_at"} {
+			delete(state, field)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"device_did": did,
-			"history":    history,
-			"total":      len(history),
+			"did":              device.DID,
+			"at":               at,
+			"device":           state,
+			"reverted_changes": len(later),
 		})
 	}
 }
 
-// RecordDeviceHistory 记录设备操作历史（辅助函数）
-func RecordDeviceHistory(db *gorm.DB, did, action, oldValue, newValue, changedBy, txHash, description string) error {
-	history := models.DeviceHistory{
-		DeviceDID:   did,
-		Action:      action,
-		OldValue:    oldValue,
-		NewValue:    newValue,
-		ChangedBy:   changedBy,
-		TxHash:      txHash,
-		Description: description,
-		CreatedAt:   time.Now(),
+// historyEntry diff=true 时的历史记录格式
+type historyEntry struct {
+	models.DeviceHistory
+	Diff []fieldChange `json:"diff"`
+}
+
+// fieldChange 单个字段的变化，嵌套字段用点分隔，如 metadata.location
+type fieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// diffHistoryValues 比较历史记录的旧值和新值，返回按字段名排序的差异
+// 元数据以 JSON 字符串保存，两边都是 JSON 对象时逐个键比较
+func diffHistoryValues(oldValue, newValue string) []fieldChange {
+	changes := []fieldChange{}
+	diffJSON("", json.RawMessage(oldValue), json.RawMessage(newValue), &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func diffJSON(path string, oldValue, newValue json.RawMessage, changes *[]fieldChange) {
+	oldObj, oldIsObj := jsonObject(path, oldValue)
+	newObj, newIsObj := jsonObject(path, newValue)
+	// 顶层的 null 表示设备不存在（注册），按空对象比较
+	if path == "" {
+		if !oldIsObj && isJSONNull(oldValue) {
+			oldObj, oldIsObj = map[string]json.RawMessage{}, true
+		}
+		if !newIsObj && isJSONNull(newValue) {
+			newObj, newIsObj = map[string]json.RawMessage{}, true
+		}
+	}
+
+	if oldIsObj && newIsObj {
+		keys := make(map[string]bool, len(oldObj)+len(newObj))
+		for k := range oldObj {
+			keys[k] = true
+		}
+		for k := range newObj {
+			keys[k] = true
+		}
+		for k := range keys {
+			field := k
+			if path != "" {
+				field = path + "." + k
+			}
+			diffJSON(field, oldObj[k], newObj[k], changes)
+		}
+		return
+	}
+
+	oldCompact, newCompact := compactJSON(oldValue), compactJSON(newValue)
+	if !bytes.Equal(oldCompact, newCompact) {
+		*changes = append(*changes, fieldChange{Field: path, Old: oldCompact, New: newCompact})
+	}
+}
+
+// jsonObject 将值解析为 JSON 对象；metadata 字段的值是 JSON 字符串，解析其内容
+func jsonObject(path string, value json.RawMessage) (map[string]json.RawMessage, bool) {
+	if len(value) == 0 {
+		return nil, false
+	}
+	if path == "metadata" {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			value = json.RawMessage(s)
+		}
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(value, &obj) != nil || obj == nil {
+		return nil, false
 	}
-	return db.Create(&history).Error
+	return obj, true
 }
 
+// compactJSON 去掉空白便于比较，空值视为 null
+func compactJSON(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		encoded, _ := json.Marshal(string(value))
+		return encoded
+	}
+	return buf.Bytes()
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return len(bytes.TrimSpace(value)) == 0 || string(bytes.TrimSpace(value)) == "null"
+}
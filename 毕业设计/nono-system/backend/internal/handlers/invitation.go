@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/models"
+)
+
+// CreateInvitation 签发一次性注册邀请码（仅管理员）
+func CreateInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Role           string `json:"role" binding:"required"`
+			Domain         string `json:"domain"`
+			Email          string `json:"email" binding:"omitempty,email"`
+			ExpiresInHours int    `json:"expires_in_hours"` // 默认72小时
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validateRoleDomain(req.Role, req.Domain); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ExpiresInHours <= 0 {
+			req.ExpiresInHours = 72
+		}
+
+		codeBytes := make([]byte, 16)
+		if _, err := rand.Read(codeBytes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation code"})
+			return
+		}
+		code := hex.EncodeToString(codeBytes)
+
+		inv := models.Invitation{
+			CodeHash:  hashInvitationCode(code),
+			Role:      req.Role,
+			Domain:    req.Domain,
+			Email:     req.Email,
+			CreatedBy: currentUsername(c),
+			ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+		}
+
+		if err := db.Create(&inv).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "invitation.create", fmt.Sprintf("invitation:%d", inv.ID), true,
+			fmt.Sprintf("role=%s domain=%s email=%s", inv.Role, inv.Domain, inv.Email))
+
+		// 邀请码明文只返回这一次
+		c.JSON(http.StatusCreated, gin.H{
+			"invitation":  inv,
+			"invite_code": code,
+		})
+	}
+}
+
+// ListInvitations 列出邀请码（仅管理员）
+func ListInvitations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var invitations []models.Invitation
+		query := db.Model(&models.Invitation{})
+
+		if c.Query("pending") == "true" {
+			query = query.Where("used_at IS NULL AND expires_at > ?", time.Now())
+		}
+
+		if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+// RevokeInvitation 作废未使用的邀请码（仅管理员）
+func RevokeInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		result := db.Where("id = ? AND used_at IS NULL", id).Delete(&models.Invitation{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or already used"})
+			return
+		}
+
+		audit.Record(db, c, "invitation.revoke", "invitation:"+id, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+	}
+}
+
+// redeemInvitation 在事务中核销邀请码，邀请码只能使用一次
+func redeemInvitation(tx *gorm.DB, code, email string) (*models.Invitation, error) {
+	var inv models.Invitation
+	if err := tx.Where("code_hash = ?", hashInvitationCode(code)).First(&inv).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidInvitation
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if inv.UsedAt != nil || now.After(inv.ExpiresAt) {
+		return nil, errInvalidInvitation
+	}
+	if inv.Email != "" && !strings.EqualFold(inv.Email, email) {
+		return nil, errInvalidInvitation
+	}
+
+	// 条件更新保证并发请求只有一个能核销成功
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND used_at IS NULL", inv.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidInvitation
+	}
+
+	return &inv, nil
+}
+
+func hashInvitationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 分页默认值和上限
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// pageParams 分页参数
+type pageParams struct {
+	Page     int
+	PageSize int
+}
+
+// parsePageParams 解析 page、page_size 查询参数
+// 参数不是正整数时返回错误，page_size 超过上限时按上限处理
+func parsePageParams(c *gin.Context, defaultSize int) (pageParams, error) {
+	p := pageParams{Page: 1, PageSize: defaultSize}
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, validationError("Invalid page, must be a positive integer")
+		}
+		p.Page = n
+	}
+	if v := c.Query("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, validationError("Invalid page_size, must be a positive integer")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		p.PageSize = n
+	}
+	return p, nil
+}
+
+// apply 按页码分页，多取一条用于判断是否还有下一页
+func (p pageParams) apply(query *gorm.DB) *gorm.DB {
+	return query.Limit(p.PageSize + 1).Offset((p.Page - 1) * p.PageSize)
+}
+
+// pageResult 统一的分页响应：key 为结果列表的字段名
+func pageResult(key string, items interface{}, total int64, p pageParams, hasMore bool) gin.H {
+	return gin.H{
+		key:         items,
+		"total":     total,
+		"page":      p.Page,
+		"page_size": p.PageSize,
+		"has_more":  hasMore,
+	}
+}
+
+// sortField 可排序字段
+type sortField struct {
+	Column string // 数据库列
+	IsTime bool   // 时间类型，游标中的值按 RFC3339 解析
+}
+
+// sortOrder 排序条件
+type sortOrder struct {
+	Name  string
+	Field sortField
+	Desc  bool
+}
+
+// parseSortOrder 解析 sort_by、sort_order 查询参数，sort_by 只能是 fields 中的字段
+func parseSortOrder(c *gin.Context, fields map[string]sortField, defaultName string) (sortOrder, error) {
+	name := c.DefaultQuery("sort_by", defaultName)
+	field, ok := fields[name]
+	if !ok {
+		names := make([]string, 0, len(fields))
+		for n := range fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return sortOrder{}, validationError("Invalid sort_by, must be one of " + strings.Join(names, ", "))
+	}
+
+	order := sortOrder{Name: name, Field: field}
+	switch c.DefaultQuery("sort_order", "desc") {
+	case "desc":
+		order.Desc = true
+	case "asc":
+	default:
+		return sortOrder{}, validationError("Invalid sort_order, must be asc or desc")
+	}
+	return order, nil
+}
+
+// apply 应用排序，并以主键作为第二排序键保证分页结果稳定
+func (o sortOrder) apply(query *gorm.DB, idColumn string) *gorm.DB {
+	dir := " ASC"
+	if o.Desc {
+		dir = " DESC"
+	}
+	return query.Order(o.Field.Column + dir).Order(idColumn + dir)
+}
+
+// pageCursor 游标：上一页最后一条记录的排序值和主键
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// encodeCursor 生成下一页的游标
+func (o sortOrder) encodeCursor(value string, id uint) string {
+	data, _ := json.Marshal(pageCursor{Sort: o.Name, Desc: o.Desc, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after 按游标（键集）分页：只查询排在游标记录之后的数据
+// 游标必须与当前排序条件一致
+func (o sortOrder) after(query *gorm.DB, idColumn, raw string) (*gorm.DB, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, validationError("Invalid cursor")
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, validationError("Invalid cursor")
+	}
+	if cur.Sort != o.Name || cur.Desc != o.Desc {
+		return nil, validationError("Cursor does not match sort_by/sort_order")
+	}
+
+	var value interface{} = cur.Value
+	if o.Field.IsTime {
+		t, err := time.Parse(time.RFC3339Nano, cur.Value)
+		if err != nil {
+			return nil, validationError("Invalid cursor")
+		}
+		value = t
+	}
+
+	op := ">"
+	if o.Desc {
+		op = "<"
+	}
+	return query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", o.Field.Column, idColumn, op), value, cur.ID), nil
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/rbac"
+)
+
+// roleNamePattern 角色名：小写字母开头，可包含小写字母、数字、下划线和连字符
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,63}$`)
+
+// roleView 角色及其权限
+type roleView struct {
+	models.Role
+	Permissions []string `json:"permissions"`
+}
+
+// ListRoles 列出全部角色及其权限（仅管理员）
+func ListRoles(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var roles []models.Role
+		if err := db.Order("builtin DESC, name").Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var bindings []models.RolePermission
+		if err := db.Order("role_name, permission").Find(&bindings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		perms := make(map[string][]string)
+		for _, b := range bindings {
+			perms[b.RoleName] = append(perms[b.RoleName], b.Permission)
+		}
+
+		views := make([]roleView, 0, len(roles))
+		for _, r := range roles {
+			p := perms[r.Name]
+			if p == nil {
+				p = []string{}
+			}
+			views = append(views, roleView{Role: r, Permissions: p})
+		}
+
+		c.JSON(http.StatusOK, views)
+	}
+}
+
+// ListPermissions 列出系统支持的全部权限（仅管理员）
+func ListPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"permissions": models.AllPermissions,
+			"data_scopes": []string{models.DataScopeAll, models.DataScopeDomain, models.DataScopeReadonly, models.DataScopeRestricted},
+		})
+	}
+}
+
+// CreateRole 创建自定义角色（仅管理员）
+func CreateRole(db *gorm.DB, roles *rbac.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name        string   `json:"name" binding:"required"`
+			Description string   `json:"description"`
+			DataScope   string   `json:"data_scope" binding:"required"`
+			Permissions []string `json:"permissions"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if !roleNamePattern.MatchString(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role name"})
+			return
+		}
+		if !models.ValidDataScope(req.DataScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data scope"})
+			return
+		}
+		perms, err := normalizePermissions(req.Permissions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var count int64
+		db.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+			return
+		}
+
+		role := models.Role{
+			Name:        req.Name,
+			Description: req.Description,
+			DataScope:   req.DataScope,
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+			return replaceRolePermissions(tx, role.Name, perms)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		roles.Invalidate()
+
+		audit.Record(db, c, "role.create", "role:"+role.Name, true,
+			fmt.Sprintf("data_scope=%s permissions=%s", role.DataScope, strings.Join(perms, ",")))
+
+		c.JSON(http.StatusCreated, roleView{Role: role, Permissions: perms})
+	}
+}
+
+// UpdateRole 更新角色说明和数据权限范围（仅管理员，内置角色不能修改数据权限范围）
+func UpdateRole(db *gorm.DB, roles *rbac.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Description *string `json:"description"`
+			DataScope   *string `json:"data_scope"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role, ok := findRole(c, db)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.DataScope != nil && *req.DataScope != role.DataScope {
+			if role.Builtin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Cannot change data scope of a builtin role"})
+				return
+			}
+			if !models.ValidDataScope(*req.DataScope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data scope"})
+				return
+			}
+			// 改为域级数据权限时，该角色的用户必须都已指定所属域
+			if *req.DataScope == models.DataScopeDomain {
+				var count int64
+				db.Model(&models.User{}).Where("role = ? AND (domain = '' OR domain IS NULL)", role.Name).Count(&count)
+				if count > 0 {
+					c.JSON(http.StatusConflict, gin.H{
+						"error":   "Some users with this role have no domain",
+						"message": fmt.Sprintf("有 %d 个该角色的用户未指定所属域", count),
+					})
+					return
+				}
+			}
+			updates["data_scope"] = *req.DataScope
+		}
+
+		if len(updates) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+
+		if err := db.Model(role).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		roles.Invalidate()
+		db.Where("name = ?", role.Name).First(role)
+
+		audit.Record(db, c, "role.update", "role:"+role.Name, true, fmt.Sprintf("%v", updates))
+
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// SetRolePermissions 替换角色的权限列表（仅管理员），修改立即对该角色的所有用户生效
+func SetRolePermissions(db *gorm.DB, roles *rbac.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Permissions []string `json:"permissions" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role, ok := findRole(c, db)
+		if !ok {
+			return
+		}
+
+		perms, err := normalizePermissions(req.Permissions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return replaceRolePermissions(tx, role.Name, perms)
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		roles.Invalidate()
+
+		audit.Record(db, c, "role.permissions", "role:"+role.Name, true, "permissions="+strings.Join(perms, ","))
+
+		c.JSON(http.StatusOK, roleView{Role: *role, Permissions: perms})
+	}
+}
+
+// DeleteRole 删除自定义角色（仅管理员），仍有用户使用该角色时不能删除，未使用的邀请码一并作废
+func DeleteRole(db *gorm.DB, roles *rbac.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := findRole(c, db)
+		if !ok {
+			return
+		}
+
+		if role.Builtin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete a builtin role"})
+			return
+		}
+
+		var userCount int64
+		db.Model(&models.User{}).Where("role = ?", role.Name).Count(&userCount)
+		if userCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Role is still assigned to users",
+				"message": fmt.Sprintf("仍有 %d 个用户使用该角色", userCount),
+			})
+			return
+		}
+		var membershipCount int64
+		db.Model(&models.UserDomain{}).Where("role = ?", role.Name).Count(&membershipCount)
+		if membershipCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Role is still assigned to domain memberships",
+				"message": fmt.Sprintf("仍有 %d 个域成员关系使用该角色", membershipCount),
+			})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("role_name = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+				return err
+			}
+			// 作废指向该角色的未使用邀请码
+			if err := tx.Where("role = ? AND used_at IS NULL", role.Name).Delete(&models.Invitation{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(role).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		roles.Invalidate()
+
+		audit.Record(db, c, "role.delete", "role:"+role.Name, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+	}
+}
+
+// findRole 按路径参数 name 查找角色，未找到时直接写入响应
+func findRole(c *gin.Context, db *gorm.DB) (*models.Role, bool) {
+	var role models.Role
+	if err := db.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &role, true
+}
+
+// normalizePermissions 校验权限名称并去重排序
+func normalizePermissions(permissions []string) ([]string, error) {
+	seen := make(map[string]bool, len(permissions))
+	result := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if !models.IsKnownPermission(p) {
+			return nil, validationError("Unknown permission: " + p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// replaceRolePermissions 在事务中替换角色的权限绑定
+func replaceRolePermissions(tx *gorm.DB, roleName string, permissions []string) error {
+	if err := tx.Where("role_name = ?", roleName).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	bindings := make([]models.RolePermission, 0, len(permissions))
+	for _, p := range permissions {
+		bindings = append(bindings, models.RolePermission{RoleName: roleName, Permission: p})
+	}
+	return tx.Create(&bindings).Error
+}
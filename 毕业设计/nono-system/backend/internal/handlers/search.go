@@ -3,11 +3,14 @@ package handlers
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/search"
 )
 
 // SearchDevices 高级搜索设备
@@ -15,6 +18,22 @@ func SearchDevices(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		query := db.Model(&models.Device{})
 
+		// 应用数据权限过滤
+		query = middleware.ApplyDeviceFilter(c, query, "devices")
+
+		// 查询语言：全文检索和字段、元数据条件，如 q=status:active fw<2.0 metadata.location=plant-3
+		if q := c.Query("q"); q != "" {
+			parsed, err := search.Parse(q)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if query, err = parsed.Apply(query); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		// 支持多个搜索条件
 		if did := c.Query("did"); did != "" {
 			query = query.Where("d_id LIKE ?", "%"+did+"%")
@@ -65,48 +84,101 @@ func SearchDevices(db *gorm.DB) gin.HandlerFunc {
 			query = query.Where("registered_at <= ?", endDate)
 		}
 
-		// 排序
-		sortBy := c.DefaultQuery("sort_by", "created_at")
-		sortOrder := c.DefaultQuery("sort_order", "desc")
-		if sortOrder == "asc" {
-			query = query.Order(sortBy + " ASC")
-		} else {
-			query = query.Order(sortBy + " DESC")
-		}
+		respondDevicePage(c, query)
+	}
+}
 
-		// 分页
-		page := c.DefaultQuery("page", "1")
-		pageSize := c.DefaultQuery("page_size", "20")
-		// 简化处理，实际应该解析为整数
-		var limit, offset int
-		if pageSize == "20" {
-			limit = 20
-		} else {
-			limit = 20
-		}
-		if page == "1" {
-			offset = 0
-		} else {
-			offset = 0
-		}
+// deviceSortFields 设备列表可排序的字段
+var deviceSortFields = map[string]sortField{
+	"created_at":    {Column: "devices.created_at", IsTime: true},
+	"registered_at": {Column: "devices.registered_at", IsTime: true},
+	"last_updated":  {Column: "devices.last_updated", IsTime: true},
+	"did":           {Column: "devices.d_id"},
+	"device_id":     {Column: "devices.device_id"},
+	"device_type":   {Column: "devices.device_type"},
+	"manufacturer":  {Column: "devices.manufacturer"},
+	"model":         {Column: "devices.model"},
+	"domain":        {Column: "devices.domain"},
+	"status":        {Column: "devices.status"},
+}
 
-		var devices []models.Device
-		var total int64
+// deviceSortValue 返回设备在排序字段上的值，用于生成游标
+func deviceSortValue(d *models.Device, name string) string {
+	switch name {
+	case "registered_at":
+		return d.RegisteredAt.Format(time.RFC3339Nano)
+	case "last_updated":
+		return d.LastUpdated.Format(time.RFC3339Nano)
+	case "did":
+		return d.DID
+	case "device_id":
+		return d.DeviceID
+	case "device_type":
+		return d.DeviceType
+	case "manufacturer":
+		return d.Manufacturer
+	case "model":
+		return d.Model
+	case "domain":
+		return d.Domain
+	case "status":
+		return d.Status
+	default:
+		return d.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
 
-		// 获取总数
-		query.Count(&total)
+// respondDevicePage 对设备查询排序、分页并写入响应
+// 支持 page/page_size 页码分页和 cursor 游标分页，设备较多时建议使用响应中的 next_cursor 翻页
+func respondDevicePage(c *gin.Context, query *gorm.DB) {
+	order, err := parseSortOrder(c, deviceSortFields, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := parsePageParams(c, defaultPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-		// 获取数据
-		if err := query.Limit(limit).Offset(offset).Find(&devices).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	cursor := c.Query("cursor")
+	query = order.apply(query, "devices.id")
+	if cursor != "" {
+		if query, err = order.after(query, "devices.id", cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		query = query.Limit(page.PageSize + 1)
+	} else {
+		query = page.apply(query)
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"total":   total,
-			"page":    page,
-			"devices": devices,
-		})
+	var devices []models.Device
+	if err := query.Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-}
 
+	hasMore := len(devices) > page.PageSize
+	if hasMore {
+		devices = devices[:page.PageSize]
+	}
+
+	resp := pageResult("devices", devices, total, page, hasMore)
+	if hasMore {
+		last := &devices[len(devices)-1]
+		resp["next_cursor"] = order.encodeCursor(deviceSortValue(last, order.Name), last.ID)
+	}
+	// 游标分页时页码没有意义
+	if cursor != "" {
+		delete(resp, "page")
+	}
+	c.JSON(http.StatusOK, resp)
+}
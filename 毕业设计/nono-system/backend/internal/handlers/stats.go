@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/middleware"
 	"nono-system/backend/internal/models"
 )
 
@@ -14,16 +15,24 @@ func GetStatistics(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		stats := make(map[string]interface{})
 
+		// 设备、域和认证统计只包含当前用户数据权限范围内的数据
+		devices := func() *gorm.DB {
+			return middleware.ApplyDeviceFilter(c, db.Model(&models.Device{}), "devices")
+		}
+		authRecords := func() *gorm.DB {
+			return middleware.ApplyAuthFilter(c, db.Model(&models.AuthRecord{}), "auth_records")
+		}
+
 		// 设备统计
 		var totalDevices int64
 		var activeDevices int64
 		var revokedDevices int64
 		var suspiciousDevices int64
 
-		db.Model(&models.Device{}).Count(&totalDevices)
-		db.Model(&models.Device{}).Where("status = ?", "active").Count(&activeDevices)
-		db.Model(&models.Device{}).Where("status = ?", "revoked").Count(&revokedDevices)
-		db.Model(&models.Device{}).Where("status = ?", "suspicious").Count(&suspiciousDevices)
+		devices().Count(&totalDevices)
+		devices().Where("status = ?", "active").Count(&activeDevices)
+		devices().Where("status = ?", "revoked").Count(&revokedDevices)
+		devices().Where("status = ?", "suspicious").Count(&suspiciousDevices)
 
 		stats["devices"] = gin.H{
 			"total":      totalDevices,
@@ -34,11 +43,11 @@ func GetStatistics(db *gorm.DB) gin.HandlerFunc {
 
 		// 域统计
 		var totalDomains int64
-		db.Model(&models.Domain{}).Count(&totalDomains)
+		middleware.ApplyDomainColumnFilter(c, db.Model(&models.Domain{}), "domains.name").Count(&totalDomains)
 
 		// 按域分组统计设备数量
 		var domainStats []gin.H
-		rows, err := db.Model(&models.Device{}).
+		rows, err := devices().
 			Select("domain, COUNT(*) as count, status").
 			Group("domain, status").
 			Rows()
@@ -87,10 +96,10 @@ func GetStatistics(db *gorm.DB) gin.HandlerFunc {
 		var failedAuths int64
 		var onChainAuths int64
 
-		db.Model(&models.AuthRecord{}).Count(&totalAuthRecords)
-		db.Model(&models.AuthRecord{}).Where("authorized = ?", true).Count(&successfulAuths)
-		db.Model(&models.AuthRecord{}).Where("authorized = ?", false).Count(&failedAuths)
-		db.Model(&models.AuthRecord{}).Where("tx_hash IS NOT NULL AND tx_hash != ''").Count(&onChainAuths)
+		authRecords().Count(&totalAuthRecords)
+		authRecords().Where("authorized = ?", true).Count(&successfulAuths)
+		authRecords().Where("authorized = ?", false).Count(&failedAuths)
+		authRecords().Where("tx_hash IS NOT NULL AND tx_hash != ''").Count(&onChainAuths)
 
 		stats["authentication"] = gin.H{
 			"total":          totalAuthRecords,
@@ -106,8 +115,8 @@ func GetStatistics(db *gorm.DB) gin.HandlerFunc {
 		var recentAuths int64
 		oneWeekAgo := db.NowFunc().AddDate(0, 0, -7)
 		
-		db.Model(&models.Device{}).Where("created_at > ?", oneWeekAgo).Count(&recentDevices)
-		db.Model(&models.AuthRecord{}).Where("timestamp > ?", oneWeekAgo).Count(&recentAuths)
+		devices().Where("created_at > ?", oneWeekAgo).Count(&recentDevices)
+		authRecords().Where("timestamp > ?", oneWeekAgo).Count(&recentAuths)
 
 		stats["recent_activity"] = gin.H{
 			"devices_registered_7d": recentDevices,
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/models"
+)
+
+// configKeyPattern 配置键：小写字母开头，可包含小写字母、数字、点、下划线和连字符
+var configKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{0,127}$`)
+
+// ListSystemConfigs 列出系统配置
+func ListSystemConfigs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var configs []models.SystemConfig
+		query := db.Model(&models.SystemConfig{})
+
+		// 按键前缀过滤，如 prefix=oracle.
+		if prefix := c.Query("prefix"); prefix != "" {
+			query = query.Where("key LIKE ?", escapeLike(prefix)+"%")
+		}
+
+		if err := query.Order("key").Find(&configs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, configs)
+	}
+}
+
+// GetSystemConfig 获取单个配置项
+func GetSystemConfig(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg, ok := findSystemConfig(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, cfg)
+	}
+}
+
+// CreateSystemConfig 新增配置项
+func CreateSystemConfig(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Key         string `json:"key" binding:"required"`
+			Value       string `json:"value"`
+			ValueType   string `json:"value_type"`
+			Description string `json:"description"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !configKeyPattern.MatchString(req.Key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid config key"})
+			return
+		}
+		if req.ValueType == "" {
+			req.ValueType = models.ConfigTypeString
+		}
+		if err := validateConfigValue(req.ValueType, req.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var count int64
+		db.Model(&models.SystemConfig{}).Where("key = ?", req.Key).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Config key already exists"})
+			return
+		}
+
+		cfg := models.SystemConfig{
+			Key:         req.Key,
+			Value:       req.Value,
+			ValueType:   req.ValueType,
+			Description: req.Description,
+			UpdatedBy:   currentUsername(c),
+		}
+		if err := db.Create(&cfg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "config.create", "config:"+cfg.Key, true, fmt.Sprintf("type=%s value=%s", cfg.ValueType, cfg.Value))
+
+		c.JSON(http.StatusCreated, cfg)
+	}
+}
+
+// UpdateSystemConfig 修改配置项的值或说明（值类型不可修改）
+func UpdateSystemConfig(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Value       *string `json:"value"`
+			Description *string `json:"description"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cfg, ok := findSystemConfig(c, db)
+		if !ok {
+			return
+		}
+
+		oldValue := cfg.Value
+		updates := map[string]interface{}{"updated_by": currentUsername(c)}
+		if req.Value != nil {
+			if err := validateConfigValue(cfg.ValueType, *req.Value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updates["value"] = *req.Value
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+
+		if err := db.Model(cfg).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		db.First(cfg, cfg.ID)
+
+		audit.Record(db, c, "config.update", "config:"+cfg.Key, true, fmt.Sprintf("old=%s new=%s", oldValue, cfg.Value))
+
+		c.JSON(http.StatusOK, cfg)
+	}
+}
+
+// DeleteSystemConfig 删除配置项
+func DeleteSystemConfig(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg, ok := findSystemConfig(c, db)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(cfg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "config.delete", "config:"+cfg.Key, true, "value="+cfg.Value)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Config deleted successfully"})
+	}
+}
+
+// findSystemConfig 按路径参数 key 查找配置项，未找到时直接写入响应
+func findSystemConfig(c *gin.Context, db *gorm.DB) (*models.SystemConfig, bool) {
+	var cfg models.SystemConfig
+	if err := db.Where("key = ?", c.Param("key")).First(&cfg).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Config not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &cfg, true
+}
+
+// validateConfigValue 按值类型校验配置值
+func validateConfigValue(valueType, value string) error {
+	switch valueType {
+	case models.ConfigTypeString:
+		return nil
+	case models.ConfigTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return validationError("Value must be an integer")
+		}
+	case models.ConfigTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return validationError("Value must be a boolean")
+		}
+	case models.ConfigTypeJSON:
+		if !json.Valid([]byte(value)) {
+			return validationError("Value must be valid JSON")
+		}
+	default:
+		return validationError("Invalid value type, must be one of string, int, bool, json")
+	}
+	return nil
+}
+
+// likeEscaper 转义 LIKE 模式中的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike 转义用户输入，使其在 LIKE 模式中按字面匹配
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
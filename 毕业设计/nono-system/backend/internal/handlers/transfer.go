@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/blockchain"
+	"nono-system/backend/internal/grant"
+	"nono-system/backend/internal/middleware"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/registry"
+)
+
+var (
+	errTransferNotPending = errors.New("Transfer is no longer pending")
+	errTransferStale      = errors.New("Device or target domain has changed since the transfer was requested")
+)
+
+// RequestDeviceTransfer 发起设备迁移：将设备从当前所属域迁移到目标域
+// 发起人需要在设备所属域中具有迁移权限，同一设备同时只能有一个待审批的迁移申请
+func RequestDeviceTransfer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			TargetDomain string `json:"target_domain" binding:"required"`
+			Reason       string `json:"reason"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		device, ok := loadAccessibleDevice(c, db)
+		if !ok {
+			return
+		}
+		if !requireDomainPermission(c, device.Domain, models.PermDeviceTransfer, models.PermDeviceUpdate) {
+			return
+		}
+
+		if device.Status == "revoked" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Device is revoked"})
+			return
+		}
+		if req.TargetDomain == device.Domain {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Device already belongs to the target domain"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.Domain{}).Where("name = ?", req.TargetDomain).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target domain not found"})
+			return
+		}
+
+		db.Model(&models.DeviceTransfer{}).
+			Where("device_did = ? AND status = ?", device.DID, models.TransferPending).
+			Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Device already has a pending transfer"})
+			return
+		}
+
+		transfer := models.DeviceTransfer{
+			DeviceDID:    device.DID,
+			SourceDomain: device.Domain,
+			TargetDomain: req.TargetDomain,
+			Status:       models.TransferPending,
+			Reason:       req.Reason,
+			RequestedBy:  currentUsername(c),
+		}
+		if err := db.Create(&transfer).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "device.transfer_request", "device:"+device.DID, true,
+			fmt.Sprintf("transfer=%d %s -> %s", transfer.ID, transfer.SourceDomain, transfer.TargetDomain))
+
+		c.JSON(http.StatusCreated, transfer)
+	}
+}
+
+// ListDeviceTransfers 查询迁移申请
+// 只能看到源域或目标域可访问的申请；支持按状态、设备DID和域过滤
+func ListDeviceTransfers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := middleware.ApplyAuthFilter(c, db.Model(&models.DeviceTransfer{}), "device_transfers")
+
+		if did := c.Param("did"); did != "" {
+			device, ok := loadAccessibleDevice(c, db)
+			if !ok {
+				return
+			}
+			query = query.Where("device_did = ?", device.DID)
+		} else if did := c.Query("device_did"); did != "" {
+			query = query.Where("device_did = ?", did)
+		}
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		// 按域过滤，direction=incoming 只看迁入，outgoing 只看迁出
+		if domain := c.Query("domain"); domain != "" {
+			switch c.Query("direction") {
+			case "incoming":
+				query = query.Where("target_domain = ?", domain)
+			case "outgoing":
+				query = query.Where("source_domain = ?", domain)
+			case "":
+				query = query.Where("(source_domain = ? OR target_domain = ?)", domain, domain)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid direction, must be incoming or outgoing"})
+				return
+			}
+		}
+
+		page, err := parsePageParams(c, defaultPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var transfers []models.DeviceTransfer
+		if err := page.apply(query.Order("created_at DESC, id DESC")).Find(&transfers).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		hasMore := len(transfers) > page.PageSize
+		if hasMore {
+			transfers = transfers[:page.PageSize]
+		}
+
+		c.JSON(http.StatusOK, pageResult("transfers", transfers, total, page, hasMore))
+	}
+}
+
+// GetDeviceTransfer 获取迁移申请详情
+func GetDeviceTransfer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transfer, ok := findTransfer(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// ApproveDeviceTransfer 批准迁移申请：设备归属改为目标域
+// 审批人需要在目标域中具有迁移权限，除全局数据权限的管理员外不能审批自己发起的申请。
+// 设备迁移、申请状态、设备历史和原有跨域授权的失效在同一事务中完成；
+// 区块链客户端可用时在链上存证，存证失败不影响迁移结果
+func ApproveDeviceTransfer(db *gorm.DB, devices *registry.Service, bcClient *blockchain.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		_ = c.ShouldBindJSON(&req)
+
+		transfer, ok := findTransfer(c, db)
+		if !ok {
+			return
+		}
+		if !canReviewTransfer(c, transfer) {
+			return
+		}
+
+		reviewer := currentUsername(c)
+		var history *models.DeviceHistory
+		var invalidated int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+
+			var t models.DeviceTransfer
+			if err := locked.First(&t, transfer.ID).Error; err != nil {
+				return err
+			}
+			if t.Status != models.TransferPending {
+				return errTransferNotPending
+			}
+
+			var device models.Device
+			if err := locked.Where("d_id = ?", t.DeviceDID).First(&device).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errTransferStale
+				}
+				return err
+			}
+			if device.Domain != t.SourceDomain || device.Status == "revoked" {
+				return errTransferStale
+			}
+			var count int64
+			if err := tx.Model(&models.Domain{}).Where("name = ?", t.TargetDomain).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errTransferStale
+			}
+
+			now := time.Now()
+			var err error
+			history, err = devices.UpdateTx(tx, deviceActor(c), &device, registry.Change{
+				Action:      "transfer",
+				Description: fmt.Sprintf("设备从 %s 迁移到 %s（迁移申请 #%d，申请人 %s）", t.SourceDomain, t.TargetDomain, t.ID, t.RequestedBy),
+				Updates:     map[string]interface{}{"domain": t.TargetDomain, "last_updated": now},
+			})
+			if err != nil {
+				return err
+			}
+
+			t.Status = models.TransferApproved
+			t.ReviewedBy = reviewer
+			t.ReviewComment = req.Comment
+			t.ReviewedAt = &now
+			if err := tx.Save(&t).Error; err != nil {
+				return err
+			}
+
+			// 设备以原所属域身份获得的跨域授权全部失效
+			invalidated, err = grant.RevokeDeviceTx(tx, t.DeviceDID, reviewer,
+				fmt.Sprintf("device transferred from %s to %s", t.SourceDomain, t.TargetDomain))
+			if err != nil {
+				return err
+			}
+
+			*transfer = t
+			return nil
+		})
+		if errors.Is(err, errTransferNotPending) || errors.Is(err, errTransferStale) || errors.Is(err, registry.ErrVersionConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "device.transfer_approve", "device:"+transfer.DeviceDID, true,
+			fmt.Sprintf("transfer=%d %s -> %s invalidated_auth=%d", transfer.ID, transfer.SourceDomain, transfer.TargetDomain, invalidated))
+
+		response := gin.H{
+			"transfer":                   transfer,
+			"invalidated_authorizations": invalidated,
+		}
+
+		// 链上存证
+		if bcClient != nil && bcClient.IsConnected() {
+			txHash, err := bcClient.TransferDevice(transfer.DeviceDID, transfer.SourceDomain, transfer.TargetDomain)
+			if err != nil {
+				log.Printf("ApproveDeviceTransfer: failed to anchor transfer %d on chain: %v", transfer.ID, err)
+				response["anchor_error"] = err.Error()
+			} else {
+				transfer.TxHash = txHash
+				db.Model(&models.DeviceTransfer{}).Where("id = ?", transfer.ID).Update("tx_hash", txHash)
+				if err := devices.SetTxHash(history, txHash); err != nil {
+					log.Printf("ApproveDeviceTransfer: failed to save tx hash for transfer %d: %v", transfer.ID, err)
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// RejectDeviceTransfer 拒绝迁移申请，权限要求与批准相同
+func RejectDeviceTransfer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		_ = c.ShouldBindJSON(&req)
+
+		transfer, ok := findTransfer(c, db)
+		if !ok {
+			return
+		}
+		if !canReviewTransfer(c, transfer) {
+			return
+		}
+
+		now := time.Now()
+		if !closeTransfer(c, db, transfer, map[string]interface{}{
+			"status":         models.TransferRejected,
+			"reviewed_by":    currentUsername(c),
+			"review_comment": req.Comment,
+			"reviewed_at":    now,
+		}) {
+			return
+		}
+
+		audit.Record(db, c, "device.transfer_reject", "device:"+transfer.DeviceDID, true,
+			fmt.Sprintf("transfer=%d", transfer.ID))
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// CancelDeviceTransfer 撤回迁移申请：申请人或在源域中具有迁移权限的用户可以撤回
+func CancelDeviceTransfer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transfer, ok := findTransfer(c, db)
+		if !ok {
+			return
+		}
+		if transfer.RequestedBy != currentUsername(c) &&
+			!requireDomainPermission(c, transfer.SourceDomain, models.PermDeviceTransfer, models.PermDeviceUpdate) {
+			return
+		}
+
+		if !closeTransfer(c, db, transfer, map[string]interface{}{"status": models.TransferCancelled}) {
+			return
+		}
+
+		audit.Record(db, c, "device.transfer_cancel", "device:"+transfer.DeviceDID, true,
+			fmt.Sprintf("transfer=%d", transfer.ID))
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// closeTransfer 结束待审批的申请（拒绝或撤回），申请已被处理时返回409
+func closeTransfer(c *gin.Context, db *gorm.DB, transfer *models.DeviceTransfer, updates map[string]interface{}) bool {
+	result := db.Model(&models.DeviceTransfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferPending).
+		Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errTransferNotPending.Error()})
+		return false
+	}
+	if err := db.First(transfer, transfer.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// canReviewTransfer 检查当前用户能否审批迁移申请，不能时直接写入响应
+func canReviewTransfer(c *gin.Context, transfer *models.DeviceTransfer) bool {
+	if transfer.Status != models.TransferPending {
+		c.JSON(http.StatusConflict, gin.H{"error": errTransferNotPending.Error()})
+		return false
+	}
+	if !requireDomainPermission(c, transfer.TargetDomain, models.PermDeviceTransfer, models.PermDeviceUpdate) {
+		return false
+	}
+	if transfer.RequestedBy == currentUsername(c) && c.GetString("data_permission") != "all" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot review your own transfer request"})
+		return false
+	}
+	return true
+}
+
+// findTransfer 按路径参数 id 查找迁移申请，当前用户必须能访问其源域或目标域
+func findTransfer(c *gin.Context, db *gorm.DB) (*models.DeviceTransfer, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return nil, false
+	}
+
+	var transfer models.DeviceTransfer
+	if err := db.First(&transfer, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !middleware.CheckDomainAccess(c, transfer.SourceDomain) && !middleware.CheckDomainAccess(c, transfer.TargetDomain) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this transfer"})
+		return nil, false
+	}
+	return &transfer, true
+}
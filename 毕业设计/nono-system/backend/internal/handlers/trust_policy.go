@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/middleware"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/trust"
+)
+
+// GetTrustPolicy 获取目标域的信任策略
+func GetTrustPolicy(policies *trust.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if !requireDomainAccess(c, name) {
+			return
+		}
+
+		policy, err := policies.Get(name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if policy == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trust policy not found, cross-domain auth into this domain is not restricted", "domain": name})
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// PutTrustPolicy 创建或整体替换目标域的信任策略
+func PutTrustPolicy(db *gorm.DB, policies *trust.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+
+		var req struct {
+			DefaultAction string             `json:"default_action"`
+			Timezone      string             `json:"timezone"`
+			Rules         []models.TrustRule `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !requireDomainPermission(c, name, models.PermTrustManage) {
+			return
+		}
+		if _, ok := findDomain(c, db, name); !ok {
+			return
+		}
+
+		policy := &models.TrustPolicy{
+			DefaultAction: req.DefaultAction,
+			Timezone:      req.Timezone,
+			Rules:         req.Rules,
+		}
+		if err := trust.Validate(policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		policy, err := policies.Put(name, policy, currentUsername(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "trust_policy.update", "domain:"+name, true,
+			fmt.Sprintf("default_action=%s rules=%d", policy.DefaultAction, len(policy.Rules)))
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// DeleteTrustPolicy 删除目标域的信任策略，删除后跨域认证不再受限制
+func DeleteTrustPolicy(db *gorm.DB, policies *trust.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if !requireDomainPermission(c, name, models.PermTrustManage) {
+			return
+		}
+
+		deleted, err := policies.Delete(name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trust policy not found", "domain": name})
+			return
+		}
+
+		audit.Record(db, c, "trust_policy.delete", "domain:"+name, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"message": "Trust policy deleted successfully"})
+	}
+}
+
+// EvaluateTrustPolicy 试算目标域的信任策略：给定设备和时间（at，RFC3339，默认当前时间），返回匹配的规则和结果
+// 源域默认为设备当前所属域；调用方需能访问目标域和该设备
+func EvaluateTrustPolicy(db *gorm.DB, policies *trust.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if !requireDomainAccess(c, name) {
+			return
+		}
+
+		var req struct {
+			DeviceDID    string `json:"device_did" binding:"required"`
+			SourceDomain string `json:"source_domain"`
+			At           string `json:"at"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		at := time.Now()
+		if req.At != "" {
+			t, err := time.Parse(time.RFC3339, req.At)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC3339"})
+				return
+			}
+			at = t
+		}
+
+		var device models.Device
+		if err := db.Where("d_id = ?", req.DeviceDID).First(&device).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !middleware.CheckDeviceAccess(c, &device) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this device"})
+			return
+		}
+		sourceDomain := req.SourceDomain
+		if sourceDomain == "" {
+			sourceDomain = device.Domain
+		}
+
+		decision, err := policies.Decide(name, &device, sourceDomain, at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"target_domain": name,
+			"source_domain": sourceDomain,
+			"device_did":    device.DID,
+			"at":            at,
+			"decision":      decision,
+		})
+	}
+}
+
+// requireDomainAccess 检查当前用户是否可以访问指定域，不能访问时写入403
+func requireDomainAccess(c *gin.Context, domain string) bool {
+	if middleware.CheckDomainAccess(c, domain) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this domain", "domain": domain})
+	return false
+}
+
+// findDomain 按名称查找域，不存在时写入404
+func findDomain(c *gin.Context, db *gorm.DB, name string) (*models.Domain, bool) {
+	var domain models.Domain
+	if err := db.Where("name = ?", name).First(&domain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &domain, true
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/loginguard"
+	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/session"
+	"nono-system/backend/internal/token"
+	"nono-system/backend/internal/totp"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// LoginTwoFactor 登录第二步：提交认证器验证码或恢复码，换取令牌对
+func LoginTwoFactor(db *gorm.DB, tokens *token.Manager, sessions session.Store, guard *loginguard.Guard, require2FA bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			MFAToken     string `json:"mfa_token" binding:"required"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Code == "" && req.RecoveryCode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+			return
+		}
+
+		claims, err := tokens.ParseMFA(req.MFAToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid mfa token",
+				"message": "二次验证已超时，请重新登录",
+			})
+			return
+		}
+
+		// 验证码错误与密码错误共用失败计数和锁定
+		wait, err := guard.Check(c.Request.Context(), claims.Username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login limiter unavailable"})
+			return
+		}
+		if wait > 0 {
+			audit.RecordAs(db, c, claims.UserID, claims.Username, "user.login", fmt.Sprintf("user:%d", claims.UserID), false, "rejected: locked out")
+			writeLockedOut(c, wait)
+			return
+		}
+
+		var user models.User
+		if err := db.Where("id = ? AND is_active = ? AND totp_enabled = ?", claims.UserID, true, true).First(&user).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid mfa token"})
+			return
+		}
+
+		if !verifySecondFactor(db, &user, req.Code, req.RecoveryCode) {
+			loginFailed(c, db, guard, &user, user.Username, "invalid 2fa code")
+			return
+		}
+
+		completeLogin(c, db, tokens, sessions, guard, &user, true, require2FA)
+	}
+}
+
+// EnrollTwoFactor 生成双因素认证密钥，需调用 VerifyTwoFactor 确认后才生效
+func EnrollTwoFactor(db *gorm.DB, issuer string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 重新发起启用会覆盖之前未确认的密钥
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.2fa.enroll", fmt.Sprintf("user:%d", user.ID), true, "")
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": totp.URI(issuer, user.Username, secret),
+			"message":     "请使用认证器应用扫描二维码，并提交验证码完成启用",
+		})
+	}
+}
+
+// VerifyTwoFactor 校验认证器验证码并启用双因素认证，返回恢复码
+// 当前会话同时升级为已完成二次验证的会话
+func VerifyTwoFactor(db *gorm.DB, tokens *token.Manager, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		if user.TOTPSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment not started"})
+			return
+		}
+
+		resource := fmt.Sprintf("user:%d", user.ID)
+		step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			audit.Record(db, c, "user.2fa.enable", resource, false, "invalid code")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"totp_enabled":   true,
+				"totp_last_step": step,
+			}).Error; err != nil {
+				return err
+			}
+			var err error
+			codes, err = replaceRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.2fa.enable", resource, true, "")
+
+		resp := gin.H{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+		}
+
+		// 为当前会话重新签发带二次验证标记的令牌，原刷新令牌随之失效
+		if claims, exists := c.Get("token_claims"); exists {
+			ctx := c.Request.Context()
+			sessionID := claims.(*token.Claims).SessionID
+			if sess, err := sessions.Get(ctx, sessionID); err == nil && sess != nil {
+				pair, err := tokens.IssuePair(&user, sessionID, true, sess.CreatedAt)
+				if err == nil {
+					rotated, err := sessions.Rotate(ctx, sessionID, sess.RefreshID, pair.RefreshID, pair.RefreshExpiresAt)
+					if err == nil && rotated {
+						for k, v := range tokenResponse(&user, pair) {
+							resp[k] = v
+						}
+					}
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// DisableTwoFactor 关闭双因素认证，需提交验证码或恢复码
+func DisableTwoFactor(db *gorm.DB, require2FA bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+		if require2FA && models.RoleRequiresTwoFactor(user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Two-factor authentication is required for this role",
+				"message": "该角色必须启用双因素认证，不能关闭",
+			})
+			return
+		}
+
+		resource := fmt.Sprintf("user:%d", user.ID)
+		if !verifySecondFactor(db, &user, req.Code, req.RecoveryCode) {
+			audit.Record(db, c, "user.2fa.disable", resource, false, "invalid code")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		if err := clearTwoFactor(db, &user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.2fa.disable", resource, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		resource := fmt.Sprintf("user:%d", user.ID)
+		if !verifySecondFactor(db, &user, req.Code, "") {
+			audit.Record(db, c, "user.2fa.recovery_codes", resource, false, "invalid code")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			codes, err = replaceRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.2fa.recovery_codes", resource, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// ResetTwoFactor 重置用户的双因素认证（仅管理员，用于用户丢失认证器和恢复码的情况）
+// 重置后强制该用户下线
+func ResetTwoFactor(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if err := clearTwoFactor(db, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor reset but failed to revoke sessions: " + err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.2fa.reset", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+	}
+}
+
+// verifySecondFactor 校验认证器验证码或恢复码
+// 验证码通过条件更新记录时间步，并发提交同一验证码时只有一次成功
+func verifySecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false
+		}
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	if recoveryCode != "" {
+		result := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(recoveryCode)).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+// clearTwoFactor 关闭双因素认证并删除恢复码
+func clearTwoFactor(db *gorm.DB, user *models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// replaceRecoveryCodes 删除旧恢复码并生成新的一组，返回明文（仅此一次）
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		raw := hex.EncodeToString(buf)
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 计算恢复码哈希（忽略大小写和分隔符）
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
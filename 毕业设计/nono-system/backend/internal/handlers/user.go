@@ -1,25 +1,58 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/loginguard"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/session"
+	"nono-system/backend/internal/token"
 )
 
-// RegisterUser 注册用户
-func RegisterUser(db *gorm.DB) gin.HandlerFunc {
+// 注册策略
+const (
+	RegistrationOpen       = "open"        // 允许公开注册普通用户
+	RegistrationInviteOnly = "invite_only" // 只能凭邀请码注册
+)
+
+var (
+	errUsernameTaken     = errors.New("Username already exists")
+	errInvalidInvitation = errors.New("Invalid or expired invitation code")
+)
+
+// adminBootstrapLock 创建首个管理员时使用的事务级咨询锁，多个实例同时启动时只有一个创建
+const adminBootstrapLock = 0x6e6f6e6f
+
+// validationError 请求参数校验错误，响应 400
+type validationError string
+
+func (e validationError) Error() string {
+	return string(e)
+}
+
+// RegisterUser 公开注册用户
+// 无邀请码时只能注册不属于任何域的普通用户（invite_only 策略下禁止）；持有邀请码时按邀请码绑定的角色和域注册。
+// 特权角色和域只能由邀请码或管理员指定，首个管理员在服务启动时按配置创建（见 BootstrapAdmin）
+func RegisterUser(db *gorm.DB, registrationMode string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Username string `json:"username" binding:"required"`
-			Password string `json:"password" binding:"required,min=6"`
-			Email    string `json:"email" binding:"required,email"`
-			Role     string `json:"role" binding:"required"`
-			Domain   string `json:"domain"` // 操作人员和预言机节点需要
+			Username   string `json:"username" binding:"required"`
+			Password   string `json:"password" binding:"required,min=6"`
+			Email      string `json:"email" binding:"required,email"`
+			Role       string `json:"role"`
+			Domain     string `json:"domain"`
+			InviteCode string `json:"invite_code"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -27,63 +60,192 @@ func RegisterUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 验证角色
-		validRoles := []string{models.RoleAdmin, models.RoleOperator, models.RoleOracle, models.RoleAuditor, models.RoleUser}
-		validRole := false
-		for _, role := range validRoles {
-			if req.Role == role {
-				validRole = true
-				break
+		// 凭邀请码注册：角色和域以邀请码为准
+		if req.InviteCode != "" {
+			var user *models.User
+			err := db.Transaction(func(tx *gorm.DB) error {
+				inv, err := redeemInvitation(tx, req.InviteCode, req.Email)
+				if err != nil {
+					return err
+				}
+				user, err = createUser(tx, req.Username, req.Password, req.Email, inv.Role, inv.Domain)
+				if err != nil {
+					return err
+				}
+				return tx.Model(&models.Invitation{}).Where("id = ?", inv.ID).Update("used_by", user.ID).Error
+			})
+			if err != nil {
+				writeRegisterError(c, err)
+				return
 			}
-		}
-		if !validRole {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+
+			audit.Record(db, c, "user.register", fmt.Sprintf("user:%d", user.ID), true,
+				fmt.Sprintf("username=%s role=%s via invitation", user.Username, user.Role))
+			c.JSON(http.StatusCreated, user)
 			return
 		}
 
-		// 操作人员和预言机节点必须指定域
-		if (req.Role == models.RoleOperator || req.Role == models.RoleOracle) && req.Domain == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Domain is required for operator and oracle roles"})
+		if req.Domain != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Domain can only be assigned by an invitation or an administrator"})
 			return
 		}
 
-		// 检查用户名是否已存在
-		var existingUser models.User
-		if err := db.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		role := req.Role
+		if role == "" {
+			role = models.RoleUser
+		}
+
+		switch {
+		case registrationMode == RegistrationInviteOnly:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Public registration is disabled, an invitation code is required"})
+			return
+		case role != models.RoleUser:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the user role can be self-registered, privileged accounts require an invitation"})
 			return
 		}
 
-		// 加密密码
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		user, err := createUser(db, req.Username, req.Password, req.Email, role, "")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			writeRegisterError(c, err)
 			return
 		}
 
-		user := models.User{
-			Username:  req.Username,
-			Password:  string(hashedPassword),
-			Email:     req.Email,
-			Role:      req.Role,
-			Domain:    req.Domain,
-			IsActive:  true,
-			CreatedAt: time.Now(),
+		audit.Record(db, c, "user.register", fmt.Sprintf("user:%d", user.ID), true,
+			fmt.Sprintf("username=%s role=%s", user.Username, user.Role))
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// CreateUser 管理员直接创建任意角色的用户
+func CreateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required,min=6"`
+			Email    string `json:"email" binding:"required,email"`
+			Role     string `json:"role" binding:"required"`
+			Domain   string `json:"domain"` // 操作人员和预言机节点需要
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		if err := db.Create(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		user, err := createUser(db, req.Username, req.Password, req.Email, req.Role, req.Domain)
+		if err != nil {
+			writeRegisterError(c, err)
 			return
 		}
 
-		// 不返回密码
-		user.Password = ""
+		audit.Record(db, c, "user.create", fmt.Sprintf("user:%d", user.ID), true,
+			fmt.Sprintf("username=%s role=%s domain=%s", user.Username, user.Role, user.Domain))
 		c.JSON(http.StatusCreated, user)
 	}
 }
 
+// createUser 校验角色和域、检查用户名并创建用户，返回的用户不含密码
+func createUser(db *gorm.DB, username, password, email, role, domain string) (*models.User, error) {
+	if err := validateRoleDomain(role, domain); err != nil {
+		return nil, err
+	}
+
+	// 检查用户名是否已存在
+	var existingUser models.User
+	if err := db.Where("username = ?", username).First(&existingUser).Error; err == nil {
+		return nil, errUsernameTaken
+	}
+
+	// 加密密码
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to hash password")
+	}
+
+	user := models.User{
+		Username:  username,
+		Password:  string(hashedPassword),
+		Email:     email,
+		Role:      role,
+		Domain:    domain,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+	}
+
+	if err := db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	// 不返回密码
+	user.Password = ""
+	return &user, nil
+}
+
+// writeRegisterError 将注册错误映射为HTTP状态码
+func writeRegisterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidInvitation):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.As(err, new(validationError)):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// BootstrapAdmin 系统中还没有管理员时创建首个管理员，服务启动时按配置调用
+// 已有管理员或未配置用户名时返回 nil；在事务级咨询锁内检查，多个实例同时启动时只创建一个
+func BootstrapAdmin(db *gorm.DB, username, password, email string) (*models.User, error) {
+	if username == "" {
+		return nil, nil
+	}
+	if len(password) < 6 {
+		return nil, errors.New("the initial administrator password must be at least 6 characters")
+	}
+
+	var user *models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", adminBootstrapLock).Error; err != nil {
+			return err
+		}
+		exists, err := adminExists(tx)
+		if err != nil || exists {
+			return err
+		}
+		user, err = createUser(tx, username, password, email, models.RoleAdmin, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// adminExists 检查系统中是否已有管理员
+func adminExists(db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// validateRoleDomain 校验角色是否存在，以及域级数据权限的角色（操作人员、预言机节点等）必须指定域
+func validateRoleDomain(role, domain string) error {
+	if !models.RoleExists(role) {
+		return validationError("Invalid role")
+	}
+
+	if models.GetRoleDataScope(role) == models.DataScopeDomain && domain == "" {
+		return validationError("Domain is required for domain-scoped roles")
+	}
+	return nil
+}
+
 // Login 用户登录
-func Login(db *gorm.DB) gin.HandlerFunc {
+func Login(db *gorm.DB, tokens *token.Manager, sessions session.Store, guard *loginguard.Guard, require2FA bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			Username string `json:"username" binding:"required"`
@@ -95,52 +257,357 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 检查用户名或IP是否处于锁定期
+		ctx := c.Request.Context()
+		wait, err := guard.Check(ctx, req.Username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login limiter unavailable"})
+			return
+		}
+		if wait > 0 {
+			audit.RecordAs(db, c, 0, req.Username, "user.login", "user:"+req.Username, false, "rejected: locked out")
+			writeLockedOut(c, wait)
+			return
+		}
+
 		var user models.User
 		if err := db.Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			// 用户不存在也计入失败次数，避免通过响应差异枚举用户名
+			loginFailed(c, db, guard, nil, req.Username, "unknown or inactive user")
 			return
 		}
 
 		// 验证密码
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			loginFailed(c, db, guard, &user, req.Username, "wrong password")
 			return
 		}
 
-		// 更新最后登录时间
-		user.LastLogin = time.Now()
-		db.Save(&user)
+		// 已启用双因素认证：密码校验通过后只签发短期的二次验证令牌，会话在验证码校验通过后创建
+		if user.TOTPEnabled {
+			mfaToken, err := tokens.IssueMFAToken(&user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+				return
+			}
+			audit.RecordAs(db, c, user.ID, user.Username, "user.login", fmt.Sprintf("user:%d", user.ID), true, "password verified, awaiting 2fa")
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaToken,
+				"expires_in":   int(token.MFATokenTTL.Seconds()),
+				"message":      "请输入认证器中的验证码",
+			})
+			return
+		}
 
-		// 返回用户信息和 token（简化处理，实际应该使用 JWT）
-		// 这里使用用户 ID 作为 token（实际应该生成 JWT）
-		c.JSON(http.StatusOK, gin.H{
-			"token":    user.ID,
-			"user": gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"email":    user.Email,
-				"role":     user.Role,
-				"domain":   user.Domain,
-			},
-			"permissions": models.GetRolePermissions(user.Role),
+		completeLogin(c, db, tokens, sessions, guard, &user, false, require2FA)
+	}
+}
+
+// completeLogin 登录成功：清除失败计数、记录审计日志、创建会话并签发令牌
+func completeLogin(c *gin.Context, db *gorm.DB, tokens *token.Manager, sessions session.Store, guard *loginguard.Guard, user *models.User, mfa, require2FA bool) {
+	if err := guard.Succeed(c.Request.Context(), user.Username); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", user.Username, err)
+	}
+
+	// 更新最后登录时间，清除失败计数
+	db.Model(user).Updates(map[string]interface{}{
+		"last_login":           time.Now(),
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	})
+	detail := ""
+	if mfa {
+		detail = "2fa"
+	}
+	audit.RecordAs(db, c, user.ID, user.Username, "user.login", fmt.Sprintf("user:%d", user.ID), true, detail)
+
+	sessionID, err := token.NewSessionID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	now := time.Now()
+	pair, err := tokens.IssuePair(user, sessionID, mfa, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	// 创建服务端会话，有效期与刷新令牌一致
+	sess := models.UserSession{
+		ID:        sessionID,
+		UserID:    user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		ExpiresAt: pair.RefreshExpiresAt,
+		RefreshID: pair.RefreshID,
+		CreatedAt: now,
+	}
+	if err := sessions.Create(c.Request.Context(), &sess); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	resp := tokenResponse(user, pair)
+	// 角色要求双因素认证但尚未启用：只能访问启用双因素认证相关的接口
+	if require2FA && models.RoleRequiresTwoFactor(user.Role) && !user.TOTPEnabled {
+		resp["mfa_enrollment_required"] = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loginFailed 记录失败登录：累计失败次数、必要时锁定、写入审计日志
+func loginFailed(c *gin.Context, db *gorm.DB, guard *loginguard.Guard, user *models.User, username, reason string) {
+	result, err := guard.Fail(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", username, err)
+	}
+
+	var actorID uint
+	resource := "user:" + username
+	if user != nil {
+		actorID = user.ID
+		resource = fmt.Sprintf("user:%d", user.ID)
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"failed_login_count":   result.UserFailures,
+			"last_failed_login_at": now,
+		}
+		// 只有用户名自身的锁定才记录到用户，IP锁定不代表该账户被锁定
+		if result.UserLockout > 0 {
+			updates["locked_until"] = now.Add(result.UserLockout)
+		}
+		db.Model(user).Updates(updates)
+	}
+
+	audit.RecordAs(db, c, actorID, username, "user.login", resource, false, reason)
+
+	if result.UserLockout > 0 {
+		audit.RecordAs(db, c, actorID, username, "user.lockout", resource, true,
+			fmt.Sprintf("failures=%d lockout=%s", result.UserFailures, result.UserLockout))
+	}
+	if result.IPLockout > 0 {
+		audit.RecordAs(db, c, actorID, username, "user.ip_lockout", "ip:"+c.ClientIP(), true,
+			fmt.Sprintf("lockout=%s", result.IPLockout))
+	}
+	if wait := result.Lockout(); wait > 0 {
+		writeLockedOut(c, wait)
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+}
+
+// writeLockedOut 响应账户锁定
+func writeLockedOut(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts",
+		"message":     "登录失败次数过多，账户已临时锁定",
+		"retry_after": seconds,
+	})
+}
+
+// UnlockUser 解除用户的登录锁定（仅管理员）
+func UnlockUser(db *gorm.DB, guard *loginguard.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if err := guard.Unlock(c.Request.Context(), user.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		db.Model(user).Updates(map[string]interface{}{
+			"failed_login_count":   0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
 		})
+
+		audit.Record(db, c, "user.unlock", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+	}
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对
+// 刷新令牌只能使用一次，每次刷新签发新的刷新令牌；已轮换的刷新令牌被再次使用时视为泄露，吊销整个会话。
+// 会话从登录时起不超过最长有效期，刷新不能延长
+func RefreshToken(db *gorm.DB, tokens *token.Manager, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, err := tokens.ParseRefresh(req.RefreshToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+
+		// 已注销或被强制下线的会话不能刷新
+		ctx := c.Request.Context()
+		sess, err := sessions.Get(ctx, claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+			return
+		}
+		if sess == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid refresh token",
+				"message": "会话已注销或已失效，请重新登录",
+			})
+			return
+		}
+		// 会话中没有刷新令牌ID的是轮换机制启用前创建的会话，接受其刷新令牌一次
+		if sess.RefreshID != "" && sess.RefreshID != claims.ID {
+			refreshReused(c, db, sessions, claims)
+			return
+		}
+
+		// 刷新时重新读取用户，角色、域或启用状态的变化在此生效
+		var user models.User
+		if err := db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid refresh token",
+				"message": "用户不存在或已被禁用",
+			})
+			return
+		}
+
+		pair, err := tokens.IssuePair(&user, claims.SessionID, claims.MFA, sess.CreatedAt)
+		if err != nil {
+			if errors.Is(err, token.ErrSessionLifetimeExceeded) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Invalid refresh token",
+					"message": "会话已达到最长有效期，请重新登录",
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+			return
+		}
+
+		rotated, err := sessions.Rotate(ctx, claims.SessionID, sess.RefreshID, pair.RefreshID, pair.RefreshExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+			return
+		}
+		if !rotated {
+			// 并发请求已先使用了同一个刷新令牌
+			refreshReused(c, db, sessions, claims)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokenResponse(&user, pair))
+	}
+}
+
+// refreshReused 已轮换的刷新令牌被再次使用：吊销会话、记录审计日志并拒绝请求
+func refreshReused(c *gin.Context, db *gorm.DB, sessions session.Store, claims *token.Claims) {
+	if err := sessions.Revoke(c.Request.Context(), claims.SessionID, session.ReasonRefreshReuse); err != nil {
+		log.Printf("Failed to revoke session %s after refresh token reuse: %v", claims.SessionID, err)
+	}
+	audit.RecordAs(db, c, claims.UserID, claims.Username, "user.refresh_reuse", fmt.Sprintf("user:%d", claims.UserID), false,
+		"session="+claims.SessionID)
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":   "Invalid refresh token",
+		"message": "刷新令牌已被使用，会话已吊销，请重新登录",
+	})
+}
+
+// Logout 注销当前会话
+func Logout(sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := c.Get("token_claims")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		sessionID := claims.(*token.Claims).SessionID
+		if err := sessions.Revoke(c.Request.Context(), sessionID, session.ReasonLogout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+// RevokeUserSessions 强制用户下线，吊销其所有会话（仅管理员）
+func RevokeUserSessions(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.revoke_sessions", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked", "user_id": user.ID})
+	}
+}
+
+// tokenResponse 构造登录/刷新的响应
+func tokenResponse(user *models.User, pair *token.Pair) gin.H {
+	return gin.H{
+		"token":              pair.AccessToken,
+		"refresh_token":      pair.RefreshToken,
+		"token_type":         pair.TokenType,
+		"expires_in":         pair.ExpiresIn,
+		"refresh_expires_at": pair.RefreshExpiresAt,
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     user.Role,
+			"domain":   user.Domain,
+		},
+		"permissions": models.GetRolePermissions(user.Role),
 	}
 }
 
 // GetCurrentUser 获取当前用户信息
-func GetCurrentUser() gin.HandlerFunc {
+func GetCurrentUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user, exists := c.Get("user")
+		userID, exists := c.Get("user_id")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
-		u := user.(*models.User)
+		var u models.User
+		if err := db.First(&u, userID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		u.Password = "" // 不返回密码
 
 		c.JSON(http.StatusOK, gin.H{
-			"user": u,
+			"user":        u,
 			"permissions": models.GetRolePermissions(u.Role),
 		})
 	}
@@ -149,7 +616,12 @@ func GetCurrentUser() gin.HandlerFunc {
 // ListUsers 列出用户（仅管理员）
 func ListUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var users []models.User
+		page, err := parsePageParams(c, defaultPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		query := db.Model(&models.User{})
 
 		// 支持过滤
@@ -161,17 +633,252 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 			query = query.Where("domain = ?", domain)
 		}
 
-		if err := query.Find(&users).Error; err != nil {
+		// 只看当前处于登录锁定期的用户
+		if c.Query("locked") == "true" {
+			query = query.Where("locked_until > ?", time.Now())
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var users []models.User
+		if err := page.apply(query.Order("id")).Find(&users).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		hasMore := len(users) > page.PageSize
+		if hasMore {
+			users = users[:page.PageSize]
+		}
+
 		// 不返回密码
 		for i := range users {
 			users[i].Password = ""
 		}
 
-		c.JSON(http.StatusOK, users)
+		c.JSON(http.StatusOK, pageResult("users", users, total, page, hasMore))
+	}
+}
+
+// UpdateUser 更新用户角色、域或邮箱（仅管理员）
+// 角色或域发生变化时，用户的所有会话被强制下线，重新登录后新权限生效
+func UpdateUser(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Role   *string `json:"role"`
+			Domain *string `json:"domain"`
+			Email  *string `json:"email" binding:"omitempty,email"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		role, domain := user.Role, user.Domain
+		if req.Role != nil {
+			role = *req.Role
+		}
+		if req.Domain != nil {
+			domain = *req.Domain
+		}
+
+		if err := validateRoleDomain(role, domain); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 管理员不能修改自己的角色，避免误操作导致系统失去管理员
+		if user.ID == c.GetUint("user_id") && role != user.Role {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change your own role"})
+			return
+		}
+
+		detail := fmt.Sprintf("role: %s -> %s, domain: %s -> %s", user.Role, role, user.Domain, domain)
+		privilegeChanged := role != user.Role || domain != user.Domain
+
+		user.Role = role
+		user.Domain = domain
+		if req.Email != nil {
+			user.Email = *req.Email
+		}
+
+		if err := db.Save(user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if privilegeChanged {
+			if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonRoleChanged); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "User updated but failed to revoke sessions: " + err.Error()})
+				return
+			}
+		}
+
+		audit.Record(db, c, "user.update", fmt.Sprintf("user:%d", user.ID), true, detail)
+
+		user.Password = ""
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// DeactivateUser 禁用用户并强制下线（仅管理员）
+func DeactivateUser(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if user.ID == c.GetUint("user_id") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot deactivate yourself"})
+			return
+		}
+
+		if err := db.Model(user).Update("is_active", false).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonDisabled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User deactivated but failed to revoke sessions: " + err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.deactivate", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "User deactivated successfully"})
+	}
+}
+
+// ActivateUser 重新启用用户（仅管理员）
+func ActivateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if err := db.Model(user).Update("is_active", true).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.activate", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "User activated successfully"})
+	}
+}
+
+// ResetPassword 管理员重置用户密码，用户的所有会话被强制下线
+func ResetPassword(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			NewPassword string `json:"new_password" binding:"required,min=6"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		if err := setPassword(db, user, req.NewPassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset but failed to revoke sessions: " + err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.reset_password", fmt.Sprintf("user:%d", user.ID), true, "username="+user.Username)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+	}
+}
+
+// ChangeOwnPassword 用户修改自己的密码，需验证旧密码，修改后所有会话需重新登录
+func ChangeOwnPassword(db *gorm.DB, sessions session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			OldPassword string `json:"old_password" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required,min=6"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		resource := fmt.Sprintf("user:%d", user.ID)
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
+			audit.Record(db, c, "user.change_password", resource, false, "old password mismatch")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Old password is incorrect"})
+			return
+		}
+
+		if err := setPassword(db, &user, req.NewPassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sessions.RevokeAllForUser(c.Request.Context(), user.ID, session.ReasonLogout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed but failed to revoke sessions: " + err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.change_password", resource, true, "")
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully, please log in again"})
+	}
+}
+
+// setPassword 加密并保存新密码
+func setPassword(db *gorm.DB, user *models.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("Failed to hash password")
 	}
+	return db.Model(user).Update("password", string(hashedPassword)).Error
 }
 
+// findUser 按路径参数 id 查找用户，未找到时直接写入响应
+func findUser(c *gin.Context, db *gorm.DB) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &user, true
+}
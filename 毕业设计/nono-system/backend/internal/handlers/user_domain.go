@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/audit"
+	"nono-system/backend/internal/models"
+)
+
+// ListUserDomains 列出用户的域成员关系（仅管理员）
+func ListUserDomains(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		var memberships []models.UserDomain
+		if err := db.Where("user_id = ?", user.ID).Order("domain").Find(&memberships).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"primary_domain": user.Domain,
+			"primary_role":   user.Role,
+			"memberships":    memberships,
+		})
+	}
+}
+
+// GrantUserDomain 将用户加入指定域并指定其在该域中的角色（仅管理员）
+// 未指定角色时为普通用户，即只能查看该域的设备
+func GrantUserDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Domain string `json:"domain" binding:"required"`
+			Role   string `json:"role"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.RoleUser
+		}
+		if err := validateMembershipRole(req.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		// 受限只读权限的用户所属域不授予访问权限，需要通过成员关系授权
+		if req.Domain == user.Domain && models.GetRoleDataScope(user.Role) != models.DataScopeRestricted {
+			c.JSON(http.StatusConflict, gin.H{"error": "Domain is the user's primary domain"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.Domain{}).Where("name = ?", req.Domain).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		db.Model(&models.UserDomain{}).Where("user_id = ? AND domain = ?", user.ID, req.Domain).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this domain"})
+			return
+		}
+
+		membership := models.UserDomain{
+			UserID:    user.ID,
+			Domain:    req.Domain,
+			Role:      req.Role,
+			GrantedBy: currentUsername(c),
+		}
+		if err := db.Create(&membership).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.domain.grant", fmt.Sprintf("user:%d", user.ID), true,
+			fmt.Sprintf("domain=%s role=%s", req.Domain, req.Role))
+
+		c.JSON(http.StatusCreated, membership)
+	}
+}
+
+// UpdateUserDomain 修改用户在指定域中的角色（仅管理员）
+func UpdateUserDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Role string `json:"role" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateMembershipRole(req.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		var membership models.UserDomain
+		if err := db.Where("user_id = ? AND domain = ?", user.ID, c.Param("domain")).First(&membership).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Domain membership not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		oldRole := membership.Role
+		if err := db.Model(&membership).Update("role", req.Role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, c, "user.domain.update", fmt.Sprintf("user:%d", user.ID), true,
+			fmt.Sprintf("domain=%s role=%s->%s", membership.Domain, oldRole, req.Role))
+
+		c.JSON(http.StatusOK, membership)
+	}
+}
+
+// RevokeUserDomain 将用户移出指定域（仅管理员）
+func RevokeUserDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, db)
+		if !ok {
+			return
+		}
+
+		domain := c.Param("domain")
+		result := db.Where("user_id = ? AND domain = ?", user.ID, domain).Delete(&models.UserDomain{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain membership not found"})
+			return
+		}
+
+		audit.Record(db, c, "user.domain.revoke", fmt.Sprintf("user:%d", user.ID), true, "domain="+domain)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Domain membership revoked successfully"})
+	}
+}
+
+// validateMembershipRole 校验成员域中的角色：角色必须存在，且不能是全域数据权限的角色
+func validateMembershipRole(role string) error {
+	if !models.RoleExists(role) {
+		return validationError("Invalid role")
+	}
+	if models.GetRoleDataScope(role) == models.DataScopeAll {
+		return validationError("Role with global data scope cannot be assigned per domain")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 失败计数与锁定状态存储
+type Store interface {
+	// LockedFor 返回剩余锁定时长，0 表示未锁定
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// RecordFailure 记录一次失败，返回窗口期内的累计失败次数
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock 锁定指定时长
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Reset 清除失败计数和锁定
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy 锁定策略：失败次数达到 MaxAttempts 后开始锁定，
+// 此后每多失败一次锁定时长翻倍（指数退避），最长不超过 MaxLockout
+type Policy struct {
+	MaxAttempts int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration // 失败计数的统计窗口，窗口内无失败则计数清零
+}
+
+// LockoutFor 计算累计失败次数对应的锁定时长
+func (p Policy) LockoutFor(failures int) time.Duration {
+	if p.MaxAttempts <= 0 || failures < p.MaxAttempts {
+		return 0
+	}
+	d := p.BaseLockout
+	for i := p.MaxAttempts; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return d
+}
+
+// Result 一次失败登录后的状态
+type Result struct {
+	UserFailures int           // 该用户名的累计失败次数
+	UserLockout  time.Duration // 本次触发的用户名锁定时长，0 表示未锁定
+	IPLockout    time.Duration // 本次触发的IP锁定时长，0 表示未锁定
+}
+
+// Lockout 用户名和IP锁定中较长的时长，即客户端需要等待的时间
+func (r Result) Lockout() time.Duration {
+	if r.IPLockout > r.UserLockout {
+		return r.IPLockout
+	}
+	return r.UserLockout
+}
+
+// Guard 按用户名和客户端IP分别计数的登录防护
+type Guard struct {
+	store Store
+	user  Policy
+	ip    Policy
+}
+
+// New 创建登录防护
+func New(store Store, user, ip Policy) *Guard {
+	return &Guard{store: store, user: user, ip: ip}
+}
+
+func userKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check 返回用户名或IP中较长的剩余锁定时长
+func (g *Guard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	userWait, err := g.store.LockedFor(ctx, userKey(username))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.store.LockedFor(ctx, ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	if ipWait > userWait {
+		return ipWait, nil
+	}
+	return userWait, nil
+}
+
+// Fail 记录一次失败登录，达到阈值时锁定
+func (g *Guard) Fail(ctx context.Context, username, ip string) (Result, error) {
+	var result Result
+
+	userFailures, err := g.store.RecordFailure(ctx, userKey(username), g.user.Window)
+	if err != nil {
+		return result, err
+	}
+	result.UserFailures = userFailures
+	if d := g.user.LockoutFor(userFailures); d > 0 {
+		if err := g.store.Lock(ctx, userKey(username), d); err != nil {
+			return result, err
+		}
+		result.UserLockout = d
+	}
+
+	ipFailures, err := g.store.RecordFailure(ctx, ipKey(ip), g.ip.Window)
+	if err != nil {
+		return result, err
+	}
+	if d := g.ip.LockoutFor(ipFailures); d > 0 {
+		if err := g.store.Lock(ctx, ipKey(ip), d); err != nil {
+			return result, err
+		}
+		result.IPLockout = d
+	}
+
+	return result, nil
+}
+
+// Succeed 登录成功后清除该用户名的失败计数（IP计数不清除，避免攻击者用自己的账户重置）
+func (g *Guard) Succeed(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, userKey(username))
+}
+
+// Unlock 管理员解除用户名锁定
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, userKey(username))
+}
+
+// NewStore 根据配置创建存储，backend 为 "redis" 时使用 Redis，否则使用进程内存
+func NewStore(backend string, rdb *redis.Client) (Store, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		if rdb == nil {
+			return nil, fmt.Errorf("redis login limiter requires a redis client")
+		}
+		return NewRedisStore(rdb), nil
+	default:
+		return nil, fmt.Errorf("unsupported login limiter: %s", backend)
+	}
+}
@@ -0,0 +1,43 @@
+package loginguard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestFailSeparatesUserAndIPLockout 同一IP尝试多个用户名触发IP锁定时，各用户名自身未锁定
+func TestFailSeparatesUserAndIPLockout(t *testing.T) {
+	ctx := context.Background()
+	g := New(NewMemoryStore(),
+		Policy{MaxAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour},
+		Policy{MaxAttempts: 4, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour},
+	)
+
+	tests := []struct {
+		username    string
+		userLockout time.Duration
+		ipLockout   time.Duration
+		wait        time.Duration // Lockout()
+	}{
+		{"alice", 0, 0, 0},
+		{"bob", 0, 0, 0},
+		{"carol", 0, 0, 0},
+		{"dave", 0, time.Minute, time.Minute},
+		{"dave", 0, 2 * time.Minute, 2 * time.Minute},
+		{"dave", time.Minute, 4 * time.Minute, 4 * time.Minute},
+	}
+	for i, tt := range tests {
+		result, err := g.Fail(ctx, tt.username, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.UserLockout != tt.userLockout || result.IPLockout != tt.ipLockout {
+			t.Errorf("attempt %d (%s): user lockout %s, ip lockout %s, want %s, %s",
+				i+1, tt.username, result.UserLockout, result.IPLockout, tt.userLockout, tt.ipLockout)
+		}
+		if result.Lockout() != tt.wait {
+			t.Errorf("attempt %d (%s): Lockout() = %s, want %s", i+1, tt.username, result.Lockout(), tt.wait)
+		}
+	}
+}
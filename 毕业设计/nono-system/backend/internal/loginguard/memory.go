@@ -0,0 +1,101 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryEntries 超过该数量时清理过期条目
+const maxMemoryEntries = 10000
+
+type memoryEntry struct {
+	failures    int
+	windowEnds  time.Time
+	lockedUntil time.Time
+}
+
+// MemoryStore 进程内存储，适用于单实例部署
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// LockedFor 返回剩余锁定时长
+func (s *MemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	if wait := time.Until(e.lockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// RecordFailure 记录一次失败
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.entries) > maxMemoryEntries {
+		s.prune(now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok || now.After(e.windowEnds) {
+		e = &memoryEntry{lockedUntil: lockedUntilOf(e)}
+		s.entries[key] = e
+	}
+	e.failures++
+	e.windowEnds = now.Add(window)
+	return e.failures, nil
+}
+
+// Lock 锁定指定时长
+func (s *MemoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.lockedUntil = time.Now().Add(d)
+	return nil
+}
+
+// Reset 清除失败计数和锁定
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// prune 清理统计窗口和锁定都已过期的条目
+func (s *MemoryStore) prune(now time.Time) {
+	for key, e := range s.entries {
+		if now.After(e.windowEnds) && now.After(e.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func lockedUntilOf(e *memoryEntry) time.Time {
+	if e == nil {
+		return time.Time{}
+	}
+	return e.lockedUntil
+}
@@ -0,0 +1,60 @@
+package loginguard
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 基于 Redis 的存储，多实例部署时共享失败计数和锁定状态
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisStore 创建 Redis 存储
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+func failuresKey(key string) string {
+	return "nono:login_fail:" + key
+}
+
+func lockKey(key string) string {
+	return "nono:login_lock:" + key
+}
+
+// LockedFor 返回剩余锁定时长
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.rdb.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// 键不存在时 PTTL 返回负值
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// RecordFailure 记录一次失败
+func (s *RedisStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, failuresKey(key))
+	pipe.PExpire(ctx, failuresKey(key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Lock 锁定指定时长
+func (s *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return s.rdb.Set(ctx, lockKey(key), 1, d).Err()
+}
+
+// Reset 清除失败计数和锁定
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, failuresKey(key), lockKey(key)).Err()
+}
@@ -0,0 +1,205 @@
+// Package metadata 设备元数据校验：元数据必须是 JSON 对象，
+// 设备类型注册了 JSON Schema 时还必须符合该 Schema
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// defaultCacheTTL 缓存有效期，多实例部署时其他实例的修改最迟在该时间后生效
+const defaultCacheTTL = time.Minute
+
+// schemaURL 编译时 Schema 的资源地址，只用于解析 Schema 内部的引用
+const schemaURL = "https://nono-system.local/metadata-schema.json"
+
+// maxDetails 校验错误最多返回的明细条数
+const maxDetails = 20
+
+// ValidationError 元数据不合法
+type ValidationError struct {
+	Message string
+	Details []string // 每条为 “位置: 原因”
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Details) == 0 {
+		return e.Message
+	}
+	return e.Message + ": " + strings.Join(e.Details, "; ")
+}
+
+type cacheEntry struct {
+	schema   *jsonschema.Schema // 为 nil 表示该类型未注册 Schema
+	loadedAt time.Time
+}
+
+// Validator 按设备类型校验元数据，编译后的 Schema 在内存中缓存
+type Validator struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	schemas map[string]cacheEntry
+}
+
+// NewValidator 创建元数据校验器，ttl 不大于0时使用默认缓存有效期
+func NewValidator(db *gorm.DB, ttl time.Duration) *Validator {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Validator{db: db, ttl: ttl, schemas: make(map[string]cacheEntry)}
+}
+
+// Validate 校验设备元数据，返回规范化后的 JSON（空元数据为 {}）
+// 元数据不合法时返回 *ValidationError
+func (v *Validator) Validate(deviceType, raw string) (string, error) {
+	normalized, doc, err := Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	schema, err := v.schema(deviceType)
+	if err != nil {
+		return "", err
+	}
+	if schema == nil {
+		return normalized, nil
+	}
+	if err := Check(schema, doc); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// Invalidate 使设备类型的 Schema 缓存失效，Schema 修改或删除后调用
+func (v *Validator) Invalidate(deviceType string) {
+	v.mu.Lock()
+	delete(v.schemas, deviceType)
+	v.mu.Unlock()
+}
+
+// schema 返回设备类型的 Schema，未注册时返回 nil
+func (v *Validator) schema(deviceType string) (*jsonschema.Schema, error) {
+	if deviceType == "" {
+		return nil, nil
+	}
+
+	v.mu.RLock()
+	e, ok := v.schemas[deviceType]
+	v.mu.RUnlock()
+	if ok && time.Since(e.loadedAt) < v.ttl {
+		return e.schema, nil
+	}
+
+	var record models.DeviceTypeSchema
+	err := v.db.Where("device_type = ?", deviceType).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// 加载失败时继续使用旧缓存
+		if ok {
+			log.Printf("Failed to load metadata schema for %s: %v", deviceType, err)
+			return e.schema, nil
+		}
+		return nil, err
+	}
+
+	var schema *jsonschema.Schema
+	if err == nil {
+		schema, err = Compile(record.Schema)
+		if err != nil {
+			// 已保存的 Schema 在写入时编译过，这里失败说明数据被直接修改
+			return nil, fmt.Errorf("schema for device type %s is invalid: %w", deviceType, err)
+		}
+	}
+
+	v.mu.Lock()
+	v.schemas[deviceType] = cacheEntry{schema: schema, loadedAt: time.Now()}
+	v.mu.Unlock()
+	return schema, nil
+}
+
+// Compile 编译 JSON Schema，不允许引用外部 Schema
+func Compile(raw string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external schema references are not allowed: %s", url)
+	}
+	if err := compiler.AddResource(schemaURL, strings.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(schemaURL)
+}
+
+// Check 使用已编译的 Schema 校验元数据对象
+func Check(schema *jsonschema.Schema, doc interface{}) error {
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	details := leafErrors(ve, nil)
+	sort.Strings(details)
+	if len(details) > maxDetails {
+		details = append(details[:maxDetails], fmt.Sprintf("... and %d more", len(details)-maxDetails))
+	}
+	return &ValidationError{Message: "metadata does not match the schema for this device type", Details: details}
+}
+
+// Parse 解析元数据，必须是 JSON 对象；空元数据视为 {}
+// 返回规范化后的 JSON 和用于 Schema 校验的值
+func Parse(raw string) (string, interface{}, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "{}", map[string]interface{}{}, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", nil, &ValidationError{Message: "metadata is not valid JSON", Details: []string{err.Error()}}
+	}
+	if dec.More() {
+		return "", nil, &ValidationError{Message: "metadata is not valid JSON", Details: []string{"unexpected data after JSON object"}}
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return "", nil, &ValidationError{Message: "metadata must be a JSON object"}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return "", nil, &ValidationError{Message: "metadata is not valid JSON", Details: []string{err.Error()}}
+	}
+	return buf.String(), doc, nil
+}
+
+// leafErrors 展开嵌套的校验错误，只保留最底层的原因
+func leafErrors(ve *jsonschema.ValidationError, out []string) []string {
+	if len(ve.Causes) == 0 {
+		location := ve.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return append(out, location+": "+ve.Message)
+	}
+	for _, cause := range ve.Causes {
+		out = leafErrors(cause, out)
+	}
+	return out
+}
@@ -1,19 +1,31 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/apikey"
+	"nono-system/backend/internal/audit"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/session"
+	"nono-system/backend/internal/token"
 )
 
 // AuthMiddleware 认证中间件
-func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+// 支持两类凭证：用户登录获得的 JWT（Authorization: Bearer <jwt>），
+// 以及机器客户端的API密钥（X-API-Key: nono_... 或 Authorization: Bearer nono_...）
+func AuthMiddleware(db *gorm.DB, tokens *token.Manager, sessions session.Store, keys *apikey.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API密钥认证
+		if rawKey := c.GetHeader("X-API-Key"); rawKey != "" {
+			authenticateAPIKey(c, db, keys, rawKey)
+			return
+		}
+
 		// 从请求头获取 token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -30,49 +42,90 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		token := parts[1]
-
-		// 验证 token 并获取用户信息
-		// 这里简化处理，实际应该使用 JWT 或其他 token 验证机制
-		// token 是用户 ID（数字字符串）
-		var user models.User
-		var err error
-		
-		// 先尝试将 token 转换为数字 ID
-		if userID, parseErr := strconv.ParseUint(token, 10, 32); parseErr == nil {
-			// token 是数字，作为用户 ID 查找
-			err = db.Where("id = ? AND is_active = ?", uint(userID), true).First(&user).Error
-		} else {
-			// token 不是数字，作为用户名查找（向后兼容）
-			err = db.Where("username = ? AND is_active = ?", token, true).First(&user).Error
+		// 兼容预言机以 Bearer 方式发送API密钥
+		if apikey.IsAPIKey(parts[1]) {
+			authenticateAPIKey(c, db, keys, parts[1])
+			return
 		}
-		
+
+		// 验证签名、签发者和有效期，用户信息直接取自令牌声明
+		claims, err := tokens.ParseAccess(parts[1])
 		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-					"message": "用户不存在或已被禁用",
-				})
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-					"message": "token 验证失败",
-				})
+			message := "token 验证失败"
+			if err == token.ErrExpiredToken {
+				message = "token 已过期，请刷新或重新登录"
 			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid token",
+				"message": message,
+			})
+			c.Abort()
+			return
+		}
+
+		// 检查服务端会话，已注销或被强制下线的令牌即使未过期也拒绝
+		active, err := sessions.IsActive(c.Request.Context(), claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid token",
+				"message": "会话已注销或已失效，请重新登录",
+			})
 			c.Abort()
 			return
 		}
 
 		// 将用户信息存储到上下文
-		c.Set("user", &user)
-		c.Set("user_id", user.ID)
-		c.Set("user_role", user.Role)
-		c.Set("user_domain", user.Domain)
+		setUserContext(c, claims)
 
 		c.Next()
 	}
 }
 
+// authenticateAPIKey 验证API密钥，每次使用都写入审计日志
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, keys *apikey.Service, rawKey string) {
+	key, user, err := keys.Authenticate(rawKey, c.ClientIP())
+	if err != nil {
+		if key != nil {
+			audit.Record(db, c, "api_key.use", fmt.Sprintf("api_key:%d", key.ID), false, err.Error())
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid API key",
+			"message": "API密钥无效、已吊销或已过期",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("user_domain", user.Domain)
+	c.Set("api_key", key)
+	if scopes := key.ScopeList(); len(scopes) > 0 {
+		c.Set("api_key_scopes", scopes)
+	}
+
+	audit.Record(db, c, "api_key.use", fmt.Sprintf("api_key:%d", key.ID), true,
+		fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path))
+
+	c.Next()
+}
+
+// setUserContext 将令牌声明中的用户信息写入上下文
+func setUserContext(c *gin.Context, claims *token.Claims) {
+	user := claims.User()
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("user_domain", user.Domain)
+	c.Set("token_claims", claims)
+}
+
 // RequirePermission 权限检查中间件（支持多个权限，满足其一即可）
 func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -86,7 +139,7 @@ func RequirePermission(permissions ...string) gin.HandlerFunc {
 		u := user.(*models.User)
 		hasPermission := false
 		for _, permission := range permissions {
-			if u.HasPermission(permission) {
+			if HasPermission(c, permission) {
 				hasPermission = true
 				break
 			}
@@ -106,6 +159,30 @@ func RequirePermission(permissions ...string) gin.HandlerFunc {
 	}
 }
 
+// HasPermission 检查当前请求的用户是否具有指定权限（API密钥认证时同时受密钥授权范围限制）
+// 供处理函数在同一接口内按操作细分权限时使用
+func HasPermission(c *gin.Context, permission string) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	return user.(*models.User).HasPermission(permission) && apiKeyAllows(c, permission)
+}
+
+// apiKeyAllows 使用API密钥认证时，权限还需在密钥的授权范围内
+func apiKeyAllows(c *gin.Context, permission string) bool {
+	scopes, exists := c.Get("api_key_scopes")
+	if !exists {
+		return true
+	}
+	for _, scope := range scopes.([]string) {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // RequireRole 角色检查中间件
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -116,6 +193,13 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 			return
 		}
 
+		// 限定了权限范围的API密钥不能访问按角色授权的接口
+		if _, scoped := c.Get("api_key_scopes"); scoped {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key scope does not allow this operation"})
+			c.Abort()
+			return
+		}
+
 		u := user.(*models.User)
 		hasRole := false
 		for _, role := range roles {
@@ -139,35 +223,57 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
+// twoFactorExemptPaths 尚未启用双因素认证时仍可访问的接口（用于完成启用流程）
+var twoFactorExemptPaths = map[string]bool{
+	"/api/v1/users/me":            true,
+	"/api/v1/users/logout":        true,
+	"/api/v1/users/me/2fa/enroll": true,
+	"/api/v1/users/me/2fa/verify": true,
+}
+
+// RequireTwoFactor 强制双因素认证中间件
+// 开启后，管理员和审计员的会话必须完成二次验证才能访问其他接口；API密钥不受影响
+func RequireTwoFactor(enforced bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enforced {
+			c.Next()
+			return
+		}
+
+		claims, exists := c.Get("token_claims")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		tc := claims.(*token.Claims)
+		if tc.MFA || !models.RoleRequiresTwoFactor(tc.Role) || twoFactorExemptPaths[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Two-factor authentication required",
+			"message": "该角色必须启用双因素认证，请先完成双因素认证设置",
+		})
+		c.Abort()
+	}
+}
+
 // OptionalAuth 可选认证中间件（不强制要求认证）
-func OptionalAuth(db *gorm.DB) gin.HandlerFunc {
+func OptionalAuth(tokens *token.Manager, sessions session.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
 			parts := strings.Split(authHeader, " ")
 			if len(parts) == 2 && parts[0] == "Bearer" {
-				token := parts[1]
-				var user models.User
-				var err error
-				
-				// 先尝试将 token 转换为数字 ID
-				if userID, parseErr := strconv.ParseUint(token, 10, 32); parseErr == nil {
-					// token 是数字，作为用户 ID 查找
-					err = db.Where("id = ? AND is_active = ?", uint(userID), true).First(&user).Error
-				} else {
-					// token 不是数字，作为用户名查找（向后兼容）
-					err = db.Where("username = ? AND is_active = ?", token, true).First(&user).Error
-				}
-				
-				if err == nil {
-					c.Set("user", &user)
-					c.Set("user_id", user.ID)
-					c.Set("user_role", user.Role)
-					c.Set("user_domain", user.Domain)
+				if claims, err := tokens.ParseAccess(parts[1]); err == nil {
+					if active, err := sessions.IsActive(c.Request.Context(), claims.SessionID); err == nil && active {
+						setUserContext(c, claims)
+					}
 				}
 			}
 		}
 		c.Next()
 	}
 }
-
@@ -22,52 +22,113 @@ func FilterByDataPermission(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		u := user.(*models.User)
-		
-		// 设置数据权限类型
-		var permissionType string
-		switch u.Role {
-		case models.RoleAdmin:
-			permissionType = "all" // 全域数据权限
-		case models.RoleOperator, models.RoleOracle:
-			permissionType = "domain" // 域级数据权限
-		case models.RoleAuditor:
-			permissionType = "readonly" // 只读数据权限
-		case models.RoleUser:
-			permissionType = "restricted_readonly" // 受限只读权限
-		default:
-			permissionType = "readonly"
+
+		// 加载域成员关系，确定可访问的域
+		if models.GetRoleDataScope(u.Role) != models.DataScopeAll {
+			var memberships []models.UserDomain
+			if err := db.Where("user_id = ?", u.ID).Order("domain").Find(&memberships).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load data permission"})
+				c.Abort()
+				return
+			}
+			u.Memberships = make([]models.DomainMembership, 0, len(memberships))
+			for _, m := range memberships {
+				u.Memberships = append(u.Memberships, models.DomainMembership{Domain: m.Domain, Role: m.Role})
+			}
 		}
 
-		c.Set("data_permission", permissionType)
-		c.Set("user_domain", u.Domain)
+		setDataPermission(c, u)
 		c.Next()
 	}
 }
 
+// setDataPermission 按用户的数据权限类型和已加载的域成员关系设置上下文中的数据权限
+func setDataPermission(c *gin.Context, u *models.User) {
+	// 设置数据权限类型：all 全域、domain 域级、readonly 只读、restricted_readonly 受限只读
+	permissionType := models.GetRoleDataScope(u.Role)
+
+	// 只读权限未指定成员域时可以查看全部域，不设置可访问域；
+	// 受限只读权限的可访问域只有成员域
+	if permissionType != models.DataScopeAll && (permissionType != models.DataScopeReadonly || len(u.Memberships) > 0) {
+		c.Set("accessible_domains", u.AccessibleDomains())
+	}
+
+	c.Set("data_permission", permissionType)
+	c.Set("user_domain", u.Domain)
+}
+
 // ApplyDomainFilter 应用域过滤到查询
 func ApplyDomainFilter(c *gin.Context, query *gorm.DB, tableName string) *gorm.DB {
-	permissionType, exists := c.Get("data_permission")
-	if !exists {
+	return ApplyDomainColumnFilter(c, query, tableName+".domain")
+}
+
+// ApplyDomainColumnFilter 应用域过滤到查询，column 为保存域名的列（如 domains.name）
+func ApplyDomainColumnFilter(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	// 系统管理员和未限定成员域的只读权限可以访问所有数据；
+	// 域级权限、受限只读权限以及限定了成员域的只读权限只能访问所属域和成员域的数据
+	domains, limited := accessibleDomains(c)
+	if !limited {
 		return query
 	}
+	if len(domains) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where(column+" IN ?", domains)
+}
 
-	pt := permissionType.(string)
-	
-	// 系统管理员可以访问所有数据
-	if pt == "all" {
-		return query
+// ApplyDeviceFilter 应用设备可见性过滤到设备表查询
+// 受限只读权限可以看到公开设备、自己拥有的设备和成员域的设备（不包括所属域），其他权限类型同 ApplyDomainFilter
+func ApplyDeviceFilter(c *gin.Context, query *gorm.DB, tableName string) *gorm.DB {
+	if c.GetString("data_permission") != "restricted_readonly" {
+		return ApplyDomainFilter(c, query, tableName)
 	}
 
-	// 域级权限：只能访问自己域的数据
-	if pt == "domain" {
-		userDomain, exists := c.Get("user_domain")
-		if exists && userDomain.(string) != "" {
-			return query.Where(tableName+".domain = ?", userDomain.(string))
-		}
+	username := ""
+	if user, exists := c.Get("user"); exists {
+		username = user.(*models.User).Username
 	}
 
-	// 只读权限和受限只读权限：可以查询，但受其他权限限制
-	return query
+	visible := tableName + ".is_public = ?"
+	args := []interface{}{true}
+	if username != "" {
+		visible += " OR " + tableName + ".owner = ?"
+		args = append(args, username)
+	}
+	if domains, _ := accessibleDomains(c); len(domains) > 0 {
+		visible += " OR " + tableName + ".domain IN ?"
+		args = append(args, domains)
+	}
+	return query.Where("("+visible+")", args...)
+}
+
+// ApplyAuthFilter 应用数据权限过滤到带源域和目标域的设备记录查询（auth_records、auth_logs、device_transfers）
+// 受限只读权限只能看到自己可见设备的记录；其他只能访问部分域的用户只能看到源域或目标域可访问的记录
+func ApplyAuthFilter(c *gin.Context, query *gorm.DB, tableName string) *gorm.DB {
+	if c.GetString("data_permission") == "restricted_readonly" {
+		visible := ApplyDeviceFilter(c, query.Session(&gorm.Session{NewDB: true}).Model(&models.Device{}), "devices").Select("devices.d_id")
+		return query.Where(tableName+".device_did IN (?)", visible)
+	}
+
+	domains, limited := accessibleDomains(c)
+	if !limited {
+		return query
+	}
+	if len(domains) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where("("+tableName+".source_domain IN ? OR "+tableName+".target_domain IN ?)", domains, domains)
+}
+
+// accessibleDomains 返回当前用户可访问的域，limited 为 false 表示不限制域
+func accessibleDomains(c *gin.Context) (domains []string, limited bool) {
+	if c.GetString("data_permission") == "all" {
+		return nil, false
+	}
+	value, exists := c.Get("accessible_domains")
+	if !exists {
+		return nil, false
+	}
+	return value.([]string), true
 }
 
 // CheckDomainAccess 检查用户是否可以访问指定域
@@ -92,6 +153,15 @@ func CheckDeviceAccess(c *gin.Context, device *models.Device) bool {
 	return u.CanAccessDevice(device)
 }
 
+// CheckDomainPermission 检查当前用户在指定域中是否具有指定权限（API密钥认证时同时受密钥授权范围限制）
+func CheckDomainPermission(c *gin.Context, domain, permission string) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	return user.(*models.User).HasDomainPermission(domain, permission) && apiKeyAllows(c, permission)
+}
+
 // RequireDomainAccess 要求域访问权限的中间件
 func RequireDomainAccess(domainParam string) gin.HandlerFunc {
 	return func(c *gin.Context) {
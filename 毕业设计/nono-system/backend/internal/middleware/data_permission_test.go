@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// dryRunDB 只生成SQL、不连接数据库的会话
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// dataPermissionContext 按用户设置数据权限的请求上下文，u.Memberships 视为已从 user_domains 加载
+func dataPermissionContext(u *models.User) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user", u)
+	setDataPermission(c, u)
+	return c
+}
+
+func TestDataPermissionFilters(t *testing.T) {
+	const (
+		allDevices = `SELECT * FROM "devices" WHERE "devices"."deleted_at" IS NULL`
+		allAuth    = `SELECT * FROM "auth_records"`
+		allDomains = `SELECT * FROM "domains"`
+	)
+
+	tests := []struct {
+		name    string
+		user    *models.User
+		scope   string
+		device  string // ApplyDeviceFilter
+		domain  string // ApplyDomainFilter
+		auth    string // ApplyAuthFilter
+		domains string // ApplyDomainColumnFilter
+		// 对 domain-a（所属域）和 domain-b（无关系的域）中非公开设备的访问
+		accessA, accessB bool
+	}{
+		{
+			name:    "admin",
+			user:    &models.User{Username: "root", Role: models.RoleAdmin},
+			scope:   models.DataScopeAll,
+			device:  allDevices,
+			domain:  allDevices,
+			auth:    allAuth,
+			domains: allDomains,
+			accessA: true,
+			accessB: true,
+		},
+		{
+			name:    "operator",
+			user:    &models.User{Username: "op", Role: models.RoleOperator, Domain: "domain-a"},
+			scope:   models.DataScopeDomain,
+			device:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a') AND "devices"."deleted_at" IS NULL`,
+			domain:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a') AND "devices"."deleted_at" IS NULL`,
+			auth:    `SELECT * FROM "auth_records" WHERE (auth_records.source_domain IN ('domain-a') OR auth_records.target_domain IN ('domain-a'))`,
+			domains: `SELECT * FROM "domains" WHERE domains.name IN ('domain-a')`,
+			accessA: true,
+		},
+		{
+			name: "operator with membership",
+			user: &models.User{Username: "op", Role: models.RoleOperator, Domain: "domain-a",
+				Memberships: []models.DomainMembership{{Domain: "domain-c", Role: models.RoleUser}}},
+			scope:   models.DataScopeDomain,
+			device:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a','domain-c') AND "devices"."deleted_at" IS NULL`,
+			domain:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a','domain-c') AND "devices"."deleted_at" IS NULL`,
+			auth:    `SELECT * FROM "auth_records" WHERE (auth_records.source_domain IN ('domain-a','domain-c') OR auth_records.target_domain IN ('domain-a','domain-c'))`,
+			domains: `SELECT * FROM "domains" WHERE domains.name IN ('domain-a','domain-c')`,
+			accessA: true,
+		},
+		{
+			name:    "auditor without memberships",
+			user:    &models.User{Username: "audit", Role: models.RoleAuditor},
+			scope:   models.DataScopeReadonly,
+			device:  allDevices,
+			domain:  allDevices,
+			auth:    allAuth,
+			domains: allDomains,
+			accessA: true,
+			accessB: true,
+		},
+		{
+			name: "auditor with memberships",
+			user: &models.User{Username: "audit", Role: models.RoleAuditor,
+				Memberships: []models.DomainMembership{{Domain: "domain-a", Role: models.RoleAuditor}}},
+			scope:   models.DataScopeReadonly,
+			device:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a') AND "devices"."deleted_at" IS NULL`,
+			domain:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-a') AND "devices"."deleted_at" IS NULL`,
+			auth:    `SELECT * FROM "auth_records" WHERE (auth_records.source_domain IN ('domain-a') OR auth_records.target_domain IN ('domain-a'))`,
+			domains: `SELECT * FROM "domains" WHERE domains.name IN ('domain-a')`,
+			accessA: true,
+		},
+		{
+			// 所属域不授予受限只读权限的用户访问权限
+			name:    "restricted without memberships",
+			user:    &models.User{Username: "alice", Role: models.RoleUser, Domain: "domain-a"},
+			scope:   models.DataScopeRestricted,
+			device:  `SELECT * FROM "devices" WHERE ((devices.is_public = true OR devices.owner = 'alice')) AND "devices"."deleted_at" IS NULL`,
+			domain:  `SELECT * FROM "devices" WHERE 1 = 0 AND "devices"."deleted_at" IS NULL`,
+			auth:    `SELECT * FROM "auth_records" WHERE auth_records.device_did IN (SELECT devices.d_id FROM "devices" WHERE ((devices.is_public = true OR devices.owner = 'alice')) AND "devices"."deleted_at" IS NULL)`,
+			domains: `SELECT * FROM "domains" WHERE 1 = 0`,
+		},
+		{
+			name: "restricted with membership",
+			user: &models.User{Username: "alice", Role: models.RoleUser, Domain: "domain-a",
+				Memberships: []models.DomainMembership{{Domain: "domain-c", Role: models.RoleUser}}},
+			scope:   models.DataScopeRestricted,
+			device:  `SELECT * FROM "devices" WHERE ((devices.is_public = true OR devices.owner = 'alice' OR devices.domain IN ('domain-c'))) AND "devices"."deleted_at" IS NULL`,
+			domain:  `SELECT * FROM "devices" WHERE devices.domain IN ('domain-c') AND "devices"."deleted_at" IS NULL`,
+			auth:    `SELECT * FROM "auth_records" WHERE auth_records.device_did IN (SELECT devices.d_id FROM "devices" WHERE ((devices.is_public = true OR devices.owner = 'alice' OR devices.domain IN ('domain-c'))) AND "devices"."deleted_at" IS NULL)`,
+			domains: `SELECT * FROM "domains" WHERE domains.name IN ('domain-c')`,
+		},
+	}
+
+	db := dryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dataPermissionContext(tt.user)
+			if got := c.GetString("data_permission"); got != tt.scope {
+				t.Fatalf("data_permission = %q, want %q", got, tt.scope)
+			}
+
+			checks := []struct {
+				filter string
+				want   string
+				build  func(tx *gorm.DB) *gorm.DB
+			}{
+				{"ApplyDeviceFilter", tt.device, func(tx *gorm.DB) *gorm.DB {
+					var devices []models.Device
+					return ApplyDeviceFilter(c, tx.Model(&models.Device{}), "devices").Find(&devices)
+				}},
+				{"ApplyDomainFilter", tt.domain, func(tx *gorm.DB) *gorm.DB {
+					var devices []models.Device
+					return ApplyDomainFilter(c, tx.Model(&models.Device{}), "devices").Find(&devices)
+				}},
+				{"ApplyAuthFilter", tt.auth, func(tx *gorm.DB) *gorm.DB {
+					var records []models.AuthRecord
+					return ApplyAuthFilter(c, tx.Model(&models.AuthRecord{}), "auth_records").Find(&records)
+				}},
+				{"ApplyDomainColumnFilter", tt.domains, func(tx *gorm.DB) *gorm.DB {
+					var domains []models.Domain
+					return ApplyDomainColumnFilter(c, tx.Model(&models.Domain{}), "domains.name").Find(&domains)
+				}},
+			}
+			for _, check := range checks {
+				if got := db.ToSQL(check.build); got != check.want {
+					t.Errorf("%s:\n got  %s\n want %s", check.filter, got, check.want)
+				}
+			}
+
+			for domain, want := range map[string]bool{"domain-a": tt.accessA, "domain-b": tt.accessB} {
+				if got := CheckDomainAccess(c, domain); got != want {
+					t.Errorf("CheckDomainAccess(%s) = %v, want %v", domain, got, want)
+				}
+				device := &models.Device{DID: "did:nono:device:" + domain, Domain: domain}
+				if got := CheckDeviceAccess(c, device); got != want {
+					t.Errorf("CheckDeviceAccess(%s) = %v, want %v", domain, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRestrictedUserVisibleDevices(t *testing.T) {
+	c := dataPermissionContext(&models.User{Username: "alice", Role: models.RoleUser, Domain: "domain-a"})
+
+	tests := []struct {
+		name   string
+		device models.Device
+		want   bool
+	}{
+		{"public device in another domain", models.Device{Domain: "domain-b", IsPublic: true}, true},
+		{"owned device in another domain", models.Device{Domain: "domain-b", Owner: "alice"}, true},
+		{"private device in primary domain", models.Device{Domain: "domain-a"}, false},
+		{"device owned by someone else", models.Device{Domain: "domain-a", Owner: "bob"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckDeviceAccess(c, &tt.device); got != tt.want {
+				t.Errorf("CheckDeviceAccess = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey 机器客户端（预言机节点、外部系统）使用的API密钥
+// 明文密钥仅在创建/轮换时返回一次，数据库只保存哈希
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"column:name;not null" json:"name"`
+	Prefix     string     `gorm:"column:prefix;uniqueIndex;not null" json:"prefix"` // 公开的密钥标识，用于查找
+	KeyHash    string     `gorm:"column:key_hash;not null" json:"-"`                // SHA-256(密钥)
+	UserID     uint       `gorm:"column:user_id;index;not null" json:"user_id"`     // 绑定的身份（用户或预言机账户）
+	Scopes     string     `gorm:"column:scopes;type:text" json:"scopes"`            // 逗号分隔的权限，为空表示继承绑定身份的全部权限
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"column:last_used_ip" json:"last_used_ip,omitempty"`
+	CreatedBy  string     `gorm:"column:created_by" json:"created_by"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList 返回权限范围列表
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// IsUsable 检查密钥是否未吊销且未过期
+func (k *APIKey) IsUsable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && now.After(*k.ExpiresAt) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog 安全审计日志（用户管理、API密钥使用等敏感操作）
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ActorID   uint      `gorm:"column:actor_id;index" json:"actor_id"`
+	Actor     string    `gorm:"column:actor;index" json:"actor"`       // 操作者用户名
+	Action    string    `gorm:"column:action;index" json:"action"`     // 例如 api_key.create, api_key.use
+	Resource  string    `gorm:"column:resource;index" json:"resource"` // 操作对象，例如 api_key:3、user:5
+	Success   bool      `gorm:"column:success" json:"success"`
+	Detail    string    `gorm:"column:detail;type:text" json:"detail"`
+	IPAddress string    `gorm:"column:ip_address" json:"ip_address"`
+	UserAgent string    `gorm:"column:user_agent" json:"user_agent"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
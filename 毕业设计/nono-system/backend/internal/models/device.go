@@ -17,8 +17,10 @@ type Device struct {
 	Firmware    string    `gorm:"column:firmware" json:"firmware"`
 	Domain      string    `gorm:"column:domain;index" json:"domain"`
 	Status      string    `gorm:"column:status;default:active" json:"status"` // active, suspicious, revoked
-	Metadata    string    `gorm:"column:metadata;type:text" json:"metadata"`    // JSON格式
-	Owner       string    `gorm:"column:owner" json:"owner"`
+	Metadata    string    `gorm:"column:metadata;type:jsonb;default:'{}'" json:"metadata"` // JSON对象，按设备类型的 Schema 校验
+	Owner       string    `gorm:"column:owner;index" json:"owner"` // 设备所有者（用户名）
+	IsPublic    bool      `gorm:"column:is_public;default:false;index" json:"is_public"` // 公开设备对所有用户可见
+	Version     int64     `gorm:"column:version;not null;default:1" json:"version"` // 每次修改加1，用于乐观并发控制
 	RegisteredAt time.Time `gorm:"column:registered_at" json:"registered_at"`
 	LastUpdated  time.Time `gorm:"column:last_updated" json:"last_updated"`
 	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
@@ -36,7 +38,7 @@ type Domain struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// AuthRecord 认证记录
+// AuthRecord 认证记录，授权成功的记录同时是一个有有效期的跨域授权（grant）
 type AuthRecord struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	DeviceDID    string    `gorm:"column:device_did;index;not null" json:"device_did"`
@@ -45,6 +47,17 @@ type AuthRecord struct {
 	Authorized   bool      `gorm:"column:authorized" json:"authorized"`
 	TxHash       string    `gorm:"column:tx_hash" json:"tx_hash"` // 区块链交易哈希
 	Timestamp    time.Time `gorm:"column:timestamp" json:"timestamp"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at;index" json:"expires_at,omitempty"` // 授权有效期，仅授权成功的记录有
+	RevokedAt    *time.Time `gorm:"column:revoked_at;index" json:"revoked_at,omitempty"` // 授权失效时间，如被撤销、设备迁移到其他域
+	RevokedBy    string    `gorm:"column:revoked_by" json:"revoked_by,omitempty"`
+	RevokeReason string    `gorm:"column:revoke_reason" json:"revoke_reason,omitempty"`
+	DeviceKeyID  string    `gorm:"column:device_key_id" json:"device_key_id,omitempty"` // 设备签名验证使用的公钥，未验证签名时为空
+	TrustPolicyID *uint    `gorm:"column:trust_policy_id" json:"trust_policy_id,omitempty"`
+	TrustRuleID  *uint     `gorm:"column:trust_rule_id" json:"trust_rule_id,omitempty"`
+	TrustRule    string    `gorm:"column:trust_rule" json:"trust_rule,omitempty"`         // 匹配的信任规则名称
+	TrustDecision string   `gorm:"column:trust_decision" json:"trust_decision,omitempty"` // 信任策略决策来源：rule、default 或 no_policy
+	CredentialID string    `gorm:"column:credential_id;index" json:"credential_id,omitempty"` // 签发的可验证凭证ID
+	CredentialExpiresAt *time.Time `gorm:"column:credential_expires_at" json:"credential_expires_at,omitempty"`
 	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
 }
 
@@ -8,10 +8,11 @@ import (
 type DeviceHistory struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	DeviceDID   string    `gorm:"column:device_did;index;not null" json:"device_did"`
-	Action      string    `gorm:"column:action;index" json:"action"`               // register, update, revoke, status_change
+	Action      string    `gorm:"column:action;index" json:"action"`               // register, update, revoke, status_change, transfer
 	OldValue    string    `gorm:"column:old_value;type:text" json:"old_value"`     // JSON格式的旧值
 	NewValue    string    `gorm:"column:new_value;type:text" json:"new_value"`     // JSON格式的新值
 	ChangedBy   string    `gorm:"column:changed_by" json:"changed_by"`             // 操作者
+	ClientIP    string    `gorm:"column:client_ip" json:"client_ip"`               // 操作者的客户端IP
 	TxHash      string    `gorm:"column:tx_hash" json:"tx_hash"`                   // 区块链交易哈希（如果有）
 	Description string    `gorm:"column:description;type:text" json:"description"` // 操作描述
 	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
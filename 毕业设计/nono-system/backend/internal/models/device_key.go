@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// 设备公钥状态
+const (
+	DeviceKeyActive  = "active"
+	DeviceKeyRevoked = "revoked"
+)
+
+// DeviceKey 设备登记的公钥，设备用对应私钥签名挑战以证明身份
+// 公钥以 hex 保存：Ed25519 为32字节，secp256k1 为33字节压缩格式
+type DeviceKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	DeviceDID  string     `gorm:"column:device_did;not null;uniqueIndex:idx_device_keys_did_key" json:"device_did"`
+	KeyID      string     `gorm:"column:key_id;size:64;not null;uniqueIndex:idx_device_keys_did_key" json:"key_id"` // DID 文档中验证方法的片段，如 key-1
+	Algorithm  string     `gorm:"column:algorithm;size:16;not null" json:"algorithm"`                               // Ed25519 或 secp256k1
+	PublicKey  string     `gorm:"column:public_key;not null" json:"public_key"`
+	Status     string     `gorm:"column:status;size:16;not null;default:'active'" json:"status"`
+	CreatedBy  string     `gorm:"column:created_by" json:"created_by"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (DeviceKey) TableName() string {
+	return "device_keys"
+}
+
+// DeviceChallenge 设备认证挑战，一次性使用
+type DeviceChallenge struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	DeviceDID string     `gorm:"column:device_did;index;not null" json:"device_did"`
+	Nonce     string     `gorm:"column:nonce;uniqueIndex;not null" json:"nonce"`
+	Audience  string     `gorm:"column:audience" json:"audience,omitempty"` // 限定使用的目标域，为空表示不限
+	IssuedBy  string     `gorm:"column:issued_by" json:"issued_by"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	KeyID     string     `gorm:"column:key_id" json:"key_id,omitempty"` // 完成签名验证使用的公钥
+	CreatedAt time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (DeviceChallenge) TableName() string {
+	return "device_challenges"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// 设备迁移申请状态
+const (
+	TransferPending   = "pending"   // 待目标域审批
+	TransferApproved  = "approved"  // 已批准，设备已迁移
+	TransferRejected  = "rejected"  // 已拒绝
+	TransferCancelled = "cancelled" // 申请人已撤回
+)
+
+// DeviceTransfer 设备在域之间迁移的申请
+// 由源域操作人员发起，目标域操作人员或管理员审批，批准后设备归属目标域
+type DeviceTransfer struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	DeviceDID     string     `gorm:"column:device_did;index;not null" json:"device_did"`
+	SourceDomain  string     `gorm:"column:source_domain;index;not null" json:"source_domain"`
+	TargetDomain  string     `gorm:"column:target_domain;index;not null" json:"target_domain"`
+	Status        string     `gorm:"column:status;index;size:16;not null;default:pending" json:"status"`
+	Reason        string     `gorm:"column:reason;type:text" json:"reason"` // 申请原因
+	RequestedBy   string     `gorm:"column:requested_by;index" json:"requested_by"`
+	ReviewedBy    string     `gorm:"column:reviewed_by" json:"reviewed_by"`
+	ReviewComment string     `gorm:"column:review_comment;type:text" json:"review_comment"`
+	ReviewedAt    *time.Time `gorm:"column:reviewed_at" json:"reviewed_at"`
+	TxHash        string     `gorm:"column:tx_hash" json:"tx_hash"` // 链上存证交易哈希
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeviceTransfer) TableName() string {
+	return "device_transfers"
+}
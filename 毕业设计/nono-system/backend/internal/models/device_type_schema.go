@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// DeviceTypeSchema 设备类型的元数据 JSON Schema，由管理员维护
+// 注册或修改该类型的设备时，元数据必须符合对应的 Schema
+type DeviceTypeSchema struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	DeviceType  string    `gorm:"column:device_type;uniqueIndex;size:64;not null" json:"device_type"`
+	Schema      string    `gorm:"column:schema;type:jsonb;not null" json:"schema"`
+	Description string    `gorm:"column:description" json:"description"`
+	UpdatedBy   string    `gorm:"column:updated_by" json:"updated_by"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeviceTypeSchema) TableName() string {
+	return "device_type_schemas"
+}
+
+// MetadataMigrationFailure 元数据迁移为 JSONB 时无法解析的记录
+// 原始内容保存在此表中，设备的元数据被重置为空对象
+type MetadataMigrationFailure struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	DeviceDID        string    `gorm:"column:device_did;index" json:"device_did"`
+	OriginalMetadata string    `gorm:"column:original_metadata;type:text" json:"original_metadata"`
+	Reason           string    `gorm:"column:reason" json:"reason"`
+	CreatedAt        time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (MetadataMigrationFailure) TableName() string {
+	return "metadata_migration_failures"
+}
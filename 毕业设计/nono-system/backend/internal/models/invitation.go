@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Invitation 管理员签发的一次性注册邀请码，绑定角色和域
+// 邀请码明文仅在创建时返回一次，数据库只保存哈希
+type Invitation struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CodeHash  string     `gorm:"column:code_hash;uniqueIndex;not null" json:"-"`
+	Role      string     `gorm:"column:role;not null" json:"role"`
+	Domain    string     `gorm:"column:domain" json:"domain"`
+	Email     string     `gorm:"column:email" json:"email,omitempty"` // 可选：限定受邀邮箱
+	CreatedBy string     `gorm:"column:created_by" json:"created_by"`
+	ExpiresAt time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	UsedBy    *uint      `gorm:"column:used_by" json:"used_by,omitempty"`
+	CreatedAt time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (Invitation) TableName() string {
+	return "invitations"
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"time"
+)
+
+// Role 角色（内置角色在启动时写入，管理员可创建自定义角色）
+type Role struct {
+	Name        string    `gorm:"primaryKey;size:64" json:"name"`
+	Description string    `json:"description"`
+	DataScope   string    `gorm:"not null;default:readonly" json:"data_scope"` // 数据权限范围
+	Builtin     bool      `gorm:"default:false" json:"builtin"`                // 内置角色不能删除
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Role) TableName() string {
+	return "roles"
+}
+
+// RolePermission 角色与权限的绑定
+type RolePermission struct {
+	RoleName   string    `gorm:"primaryKey;size:64" json:"role_name"`
+	Permission string    `gorm:"primaryKey;size:64" json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// RolePermissionSeed 已写入内置角色的默认权限
+// 新版本为内置角色增加的默认权限只写入一次，之后被管理员移除的权限不会在重启时恢复
+type RolePermissionSeed struct {
+	RoleName   string    `gorm:"primaryKey;size:64" json:"role_name"`
+	Permission string    `gorm:"primaryKey;size:64" json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RolePermissionSeed) TableName() string {
+	return "role_permission_seeds"
+}
+
+// 数据权限范围
+const (
+	DataScopeAll        = "all"                 // 全域数据权限
+	DataScopeDomain     = "domain"              // 域级数据权限，用户必须指定所属域
+	DataScopeReadonly   = "readonly"            // 只读数据权限
+	DataScopeRestricted = "restricted_readonly" // 受限只读权限
+)
+
+// ValidDataScope 检查数据权限范围是否合法
+func ValidDataScope(scope string) bool {
+	switch scope {
+	case DataScopeAll, DataScopeDomain, DataScopeReadonly, DataScopeRestricted:
+		return true
+	}
+	return false
+}
+
+// BuiltinRoles 内置角色
+var BuiltinRoles = []string{RoleAdmin, RoleOperator, RoleOracle, RoleAuditor, RoleUser}
+
+// BuiltinRoleDescriptions 内置角色说明
+var BuiltinRoleDescriptions = map[string]string{
+	RoleAdmin:    "系统管理员",
+	RoleOperator: "系统操作人员",
+	RoleOracle:   "预言机节点",
+	RoleAuditor:  "管理/审计人员",
+	RoleUser:     "普通用户",
+}
+
+// AllPermissions 系统支持的全部权限，为角色分配权限时只能从中选择
+var AllPermissions = []string{
+	PermConfigCreate, PermConfigUpdate, PermConfigDelete, PermConfigQuery,
+	PermDomainCreate, PermDomainUpdate, PermDomainDelete, PermDomainQuery,
+	PermDeviceRegister, PermDeviceUpdate, PermDeviceRevoke, PermDeviceQuery,
+	PermDeviceRegisterDomain,
+	PermDeviceTransfer,
+	PermAuthRequest, PermAuthQuery,
+	PermTrustQuery, PermTrustManage,
+	PermDeviceStatusReport, PermDeviceStatusUpdate,
+	PermAuditQuery, PermAuditStats,
+	PermSystemView,
+}
+
+// IsKnownPermission 检查权限是否在系统支持的权限列表中
+func IsKnownPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoleDataScope 内置角色的默认数据权限范围
+func DefaultRoleDataScope(role string) string {
+	switch role {
+	case RoleAdmin:
+		return DataScopeAll
+	case RoleOperator, RoleOracle:
+		return DataScopeDomain
+	case RoleAuditor:
+		return DataScopeReadonly
+	case RoleUser:
+		return DataScopeRestricted
+	default:
+		return DataScopeReadonly
+	}
+}
+
+// PermissionResolver 角色权限来源
+type PermissionResolver interface {
+	// Permissions 返回角色的权限列表
+	Permissions(role string) []string
+	// DataScope 返回角色的数据权限范围
+	DataScope(role string) string
+	// RoleExists 检查角色是否存在
+	RoleExists(role string) bool
+}
+
+var permissionResolver PermissionResolver
+
+// SetPermissionResolver 设置角色权限来源，未设置时使用内置角色的默认权限
+func SetPermissionResolver(r PermissionResolver) {
+	permissionResolver = r
+}
+
+// GetRoleDataScope 获取角色的数据权限范围
+func GetRoleDataScope(role string) string {
+	if permissionResolver != nil {
+		return permissionResolver.DataScope(role)
+	}
+	return DefaultRoleDataScope(role)
+}
+
+// RoleExists 检查角色是否存在
+func RoleExists(role string) bool {
+	if permissionResolver != nil {
+		return permissionResolver.RoleExists(role)
+	}
+	for _, r := range BuiltinRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSession 用户登录会话（服务端会话表，用于注销和强制下线）
+type UserSession struct {
+	ID           string     `gorm:"primaryKey;size:64" json:"id"` // 会话ID，写入令牌的 sid 声明
+	UserID       uint       `gorm:"column:user_id;index;not null" json:"user_id"`
+	IPAddress    string     `gorm:"column:ip_address" json:"ip_address"`
+	UserAgent    string     `gorm:"column:user_agent" json:"user_agent"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	RevokedAt    *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	RevokeReason string     `gorm:"column:revoke_reason" json:"revoke_reason,omitempty"` // logout, admin, disabled, role_changed, refresh_reuse
+	RefreshID    string     `gorm:"column:refresh_id;size:64" json:"-"`                  // 当前有效的刷新令牌ID（jti），刷新时轮换
+	CreatedAt    time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// SystemConfig 运行时系统配置项（键值对），由管理员通过接口维护
+type SystemConfig struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Key         string    `gorm:"column:key;uniqueIndex;size:128;not null" json:"key"`
+	Value       string    `gorm:"column:value;type:text" json:"value"`
+	ValueType   string    `gorm:"column:value_type;default:string" json:"value_type"` // string, int, bool, json
+	Description string    `gorm:"column:description" json:"description"`
+	UpdatedBy   string    `gorm:"column:updated_by" json:"updated_by"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SystemConfig) TableName() string {
+	return "system_configs"
+}
+
+// 配置值类型
+const (
+	ConfigTypeString = "string"
+	ConfigTypeInt    = "int"
+	ConfigTypeBool   = "bool"
+	ConfigTypeJSON   = "json"
+)
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// 信任策略的处理结果
+const (
+	TrustAllow = "allow"
+	TrustDeny  = "deny"
+)
+
+// TrustPolicy 目标域的跨域信任策略
+// 跨域认证时按优先级依次匹配规则，第一条匹配的规则决定允许或拒绝；没有规则匹配时使用 DefaultAction。
+// 目标域没有配置策略时不做限制
+type TrustPolicy struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	TargetDomain  string      `gorm:"column:target_domain;uniqueIndex;not null" json:"target_domain"`
+	DefaultAction string      `gorm:"column:default_action;size:16;not null;default:'deny'" json:"default_action"`
+	Timezone      string      `gorm:"column:timezone;size:64;not null;default:'UTC'" json:"timezone"` // 时间窗口使用的时区（IANA 名称）
+	UpdatedBy     string      `gorm:"column:updated_by" json:"updated_by"`
+	Rules         []TrustRule `gorm:"foreignKey:PolicyID;constraint:OnDelete:CASCADE" json:"rules"`
+	CreatedAt     time.Time   `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time   `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (TrustPolicy) TableName() string {
+	return "trust_policies"
+}
+
+// TrustRule 信任策略中的一条规则，所有条件都满足时规则匹配，未设置的条件不限制
+type TrustRule struct {
+	ID            uint         `gorm:"primaryKey" json:"id"`
+	PolicyID      uint         `gorm:"column:policy_id;index;not null" json:"-"`
+	Name          string       `gorm:"column:name;size:128;not null" json:"name"`
+	Priority      int          `gorm:"column:priority;not null" json:"priority"` // 越小越先匹配
+	Effect        string       `gorm:"column:effect;size:16;not null" json:"effect"`
+	SourceDomains []string     `gorm:"column:source_domains;type:jsonb;serializer:json" json:"source_domains"` // 源域，* 表示任意
+	DeviceTypes   []string     `gorm:"column:device_types;type:jsonb;serializer:json" json:"device_types,omitempty"`
+	MinFirmware   string       `gorm:"column:min_firmware" json:"min_firmware,omitempty"` // 固件版本下限（含）
+	MaxFirmware   string       `gorm:"column:max_firmware" json:"max_firmware,omitempty"` // 固件版本上限（含）
+	TimeWindows   []TimeWindow `gorm:"column:time_windows;type:jsonb;serializer:json" json:"time_windows,omitempty"`
+	// MaxSessionMinutes 授权的最长有效时间（分钟），0 表示使用系统默认值
+	MaxSessionMinutes int `gorm:"column:max_session_minutes;not null;default:0" json:"max_session_minutes,omitempty"`
+}
+
+// TableName 指定表名
+func (TrustRule) TableName() string {
+	return "trust_rules"
+}
+
+// TimeWindow 允许匹配的时间段，End 早于 Start 时表示跨越午夜
+type TimeWindow struct {
+	Days  []string `json:"days,omitempty"` // mon、tue……sun，为空表示每天
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM
+}
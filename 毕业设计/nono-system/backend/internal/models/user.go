@@ -16,9 +16,17 @@ type User struct {
 	Domain      string    `gorm:"index" json:"domain"` // 所属域（操作人员、预言机节点需要）
 	IsActive    bool      `gorm:"default:true" json:"is_active"`
 	LastLogin   time.Time `json:"last_login"`
+	FailedLoginCount  int        `gorm:"default:0" json:"failed_login_count"` // 连续登录失败次数
+	LastFailedLoginAt *time.Time `json:"last_failed_login_at,omitempty"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty"` // 登录锁定截止时间
+	TOTPSecret        string     `gorm:"column:totp_secret" json:"-"`                    // 双因素认证密钥（base32）
+	TOTPEnabled       bool       `gorm:"column:totp_enabled;default:false" json:"totp_enabled"`
+	TOTPLastStep      int64      `gorm:"column:totp_last_step;default:0" json:"-"` // 上次使用的时间步，防止验证码重放
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Memberships []DomainMembership `gorm:"-" json:"-"` // 域成员关系（来自 user_domains 表，由数据权限中间件加载）
 }
 
 // TableName 指定表名
@@ -58,10 +66,17 @@ const (
 	// 设备身份注册权限（操作人员）
 	PermDeviceRegisterDomain = "device:register:domain"
 
+	// 设备跨域迁移权限：在源域发起迁移、在目标域审批迁移
+	PermDeviceTransfer = "device:transfer"
+
 	// 跨域认证权限
 	PermAuthRequest    = "auth:request"
 	PermAuthQuery      = "auth:query"
 
+	// 跨域信任策略权限：查询和试算、在目标域中管理策略
+	PermTrustQuery  = "trust:query"
+	PermTrustManage = "trust:manage"
+
 	// 设备状态权限（预言机）
 	PermDeviceStatusReport = "device:status:report"
 	PermDeviceStatusUpdate = "device:status:update"
@@ -74,8 +89,22 @@ const (
 	PermSystemView    = "system:view"
 )
 
+// RoleRequiresTwoFactor 启用强制双因素认证时，需要双因素认证的角色
+func RoleRequiresTwoFactor(role string) bool {
+	return role == RoleAdmin || role == RoleAuditor
+}
+
 // GetRolePermissions 获取角色的权限列表
+// 配置了权限来源（数据库中的角色表）时从中读取，否则使用内置角色的默认权限
 func GetRolePermissions(role string) []string {
+	if permissionResolver != nil {
+		return permissionResolver.Permissions(role)
+	}
+	return DefaultRolePermissions(role)
+}
+
+// DefaultRolePermissions 内置角色的默认权限列表，用于初始化角色表
+func DefaultRolePermissions(role string) []string {
 	permissions := make(map[string][]string)
 
 	// 系统管理员 - 全权限
@@ -83,7 +112,9 @@ func GetRolePermissions(role string) []string {
 		PermConfigCreate, PermConfigUpdate, PermConfigDelete, PermConfigQuery,
 		PermDomainCreate, PermDomainUpdate, PermDomainDelete, PermDomainQuery,
 		PermDeviceRegister, PermDeviceUpdate, PermDeviceRevoke, PermDeviceQuery,
+		PermDeviceTransfer,
 		PermAuthRequest, PermAuthQuery,
+		PermTrustQuery, PermTrustManage,
 		PermAuditQuery, PermAuditStats,
 		PermSystemView,
 	}
@@ -91,7 +122,9 @@ func GetRolePermissions(role string) []string {
 	// 系统操作人员 - 域级权限
 	permissions[RoleOperator] = []string{
 		PermDeviceRegisterDomain, PermDeviceQuery,
+		PermDeviceTransfer,
 		PermAuthRequest, PermAuthQuery,
+		PermTrustQuery, PermTrustManage,
 		PermSystemView,
 	}
 
@@ -105,6 +138,7 @@ func GetRolePermissions(role string) []string {
 	permissions[RoleAuditor] = []string{
 		PermAuditQuery, PermAuditStats,
 		PermAuthQuery,
+		PermTrustQuery,
 		PermSystemView,
 	}
 
@@ -133,29 +167,109 @@ func (u *User) HasPermission(permission string) bool {
 
 // CanAccessDomain 检查用户是否可以访问指定域
 func (u *User) CanAccessDomain(domain string) bool {
+	switch GetRoleDataScope(u.Role) {
 	// 系统管理员可以访问所有域
-	if u.Role == RoleAdmin {
+	case DataScopeAll:
 		return true
+	// 操作人员和预言机节点只能访问所属域和成员域
+	case DataScopeDomain:
+		return u.DomainRole(domain) != ""
+	// 普通用户只能访问通过成员关系授权的域，所属域不授予访问权限
+	case DataScopeRestricted:
+		return u.MemberRole(domain) != ""
 	}
-	// 操作人员和预言机节点只能访问自己的域
-	if u.Role == RoleOperator || u.Role == RoleOracle {
-		return u.Domain == domain
-	}
-	// 审计人员和普通用户可以查看（但受其他权限限制）
-	return true
+	// 审计人员可以查看全部域；指定了成员域时只能查看所属域和成员域
+	return len(u.Memberships) == 0 || u.DomainRole(domain) != ""
 }
 
 // CanAccessDevice 检查用户是否可以访问指定设备
 func (u *User) CanAccessDevice(device *Device) bool {
+	switch GetRoleDataScope(u.Role) {
 	// 系统管理员可以访问所有设备
-	if u.Role == RoleAdmin {
+	case DataScopeAll:
 		return true
+	// 普通用户只能访问公开设备、自己拥有的设备和成员域的设备
+	case DataScopeRestricted:
+		return device.IsPublic || (device.Owner != "" && device.Owner == u.Username) || u.MemberRole(device.Domain) != ""
+	}
+	return u.CanAccessDomain(device.Domain)
+}
+
+// DomainRole 返回用户在指定域中的角色：所属域使用用户自己的角色，成员域使用成员关系中的角色，
+// 不是该域成员时返回空字符串。受限只读权限的用户所属域不授予角色，只使用成员关系
+func (u *User) DomainRole(domain string) string {
+	if domain == "" {
+		return ""
+	}
+	if u.Domain == domain && GetRoleDataScope(u.Role) != DataScopeRestricted {
+		return u.Role
+	}
+	return u.MemberRole(domain)
+}
+
+// MemberRole 返回用户通过成员关系在指定域中的角色，不是该域成员时返回空字符串
+func (u *User) MemberRole(domain string) string {
+	if domain == "" {
+		return ""
 	}
-	// 操作人员和预言机节点只能访问自己域的设备
-	if u.Role == RoleOperator || u.Role == RoleOracle {
-		return u.Domain == device.Domain
+	for _, m := range u.Memberships {
+		if m.Domain == domain {
+			return m.Role
+		}
 	}
-	// 审计人员和普通用户可以查看（但受其他权限限制）
-	return true
+	return ""
 }
 
+// AccessibleDomains 返回用户的所属域和全部成员域；受限只读权限的用户只返回成员域
+func (u *User) AccessibleDomains() []string {
+	if GetRoleDataScope(u.Role) == DataScopeRestricted {
+		return u.MemberDomains()
+	}
+	domains := make([]string, 0, len(u.Memberships)+1)
+	if u.Domain != "" {
+		domains = append(domains, u.Domain)
+	}
+	for _, m := range u.Memberships {
+		if m.Domain != u.Domain {
+			domains = append(domains, m.Domain)
+		}
+	}
+	return domains
+}
+
+// MemberDomains 返回用户通过成员关系加入的域，不包括所属域
+func (u *User) MemberDomains() []string {
+	domains := make([]string, 0, len(u.Memberships))
+	for _, m := range u.Memberships {
+		domains = append(domains, m.Domain)
+	}
+	return domains
+}
+
+// HasDomainPermission 检查用户在指定域中是否具有指定权限
+// 用户角色必须具有该权限；全域权限的用户在所有域中都有效，其他用户还需要在该域中的角色具有该权限
+func (u *User) HasDomainPermission(domain, permission string) bool {
+	if !u.HasPermission(permission) {
+		return false
+	}
+	switch GetRoleDataScope(u.Role) {
+	case DataScopeAll:
+		return true
+	case DataScopeReadonly:
+		// 未限定成员域的只读权限不按域区分
+		if len(u.Memberships) == 0 {
+			return true
+		}
+	}
+
+	role := u.DomainRole(domain)
+	if role == "" {
+		return false
+	}
+	for _, perm := range GetRolePermissions(role) {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// UserDomain 用户的域成员关系
+// 用户在所属域（User.Domain）中使用自己的角色，在成员域中使用成员关系指定的角色，
+// 例如在域A中是操作人员、在域B中只能查看
+type UserDomain struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"column:user_id;uniqueIndex:idx_user_domain;not null" json:"user_id"`
+	Domain    string    `gorm:"column:domain;uniqueIndex:idx_user_domain;index;not null" json:"domain"`
+	Role      string    `gorm:"column:role;size:64;not null;default:user" json:"role"` // 在该域中的角色
+	GrantedBy string    `gorm:"column:granted_by" json:"granted_by"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserDomain) TableName() string {
+	return "user_domains"
+}
+
+// DomainMembership 用户在某个域中的角色
+type DomainMembership struct {
+	Domain string `json:"domain"`
+	Role   string `json:"role"`
+}
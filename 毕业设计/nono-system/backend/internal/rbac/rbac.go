@@ -0,0 +1,192 @@
+package rbac
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"nono-system/backend/internal/models"
+)
+
+// defaultCacheTTL 缓存有效期，多实例部署时其他实例的修改最迟在该时间后生效
+const defaultCacheTTL = time.Minute
+
+type roleEntry struct {
+	dataScope   string
+	permissions []string
+}
+
+// Service 从数据库读取角色和权限绑定，并在内存中缓存
+type Service struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	roles    map[string]*roleEntry
+	loadedAt time.Time
+}
+
+// NewService 创建角色权限服务，ttl 不大于0时使用默认缓存有效期
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Service{db: db, ttl: ttl}
+}
+
+// Permissions 返回角色的权限列表
+func (s *Service) Permissions(role string) []string {
+	if e, ok := s.snapshot()[role]; ok {
+		return e.permissions
+	}
+	return []string{}
+}
+
+// DataScope 返回角色的数据权限范围
+func (s *Service) DataScope(role string) string {
+	if e, ok := s.snapshot()[role]; ok {
+		return e.dataScope
+	}
+	return models.DefaultRoleDataScope(role)
+}
+
+// RoleExists 检查角色是否存在
+func (s *Service) RoleExists(role string) bool {
+	_, ok := s.snapshot()[role]
+	return ok
+}
+
+// Invalidate 使缓存失效，角色或权限变更后调用
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.roles = nil
+	s.mu.Unlock()
+}
+
+// snapshot 返回当前缓存，过期或失效时重新加载
+func (s *Service) snapshot() map[string]*roleEntry {
+	s.mu.RLock()
+	roles, loadedAt := s.roles, s.loadedAt
+	s.mu.RUnlock()
+	if roles != nil && time.Since(loadedAt) < s.ttl {
+		return roles
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 其他请求可能已经完成加载
+	if s.roles != nil && time.Since(s.loadedAt) < s.ttl {
+		return s.roles
+	}
+
+	loaded, err := s.load()
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		// 加载失败时继续使用旧缓存；没有缓存时退回内置角色的默认权限
+		if s.roles == nil {
+			return builtinRoles()
+		}
+		return s.roles
+	}
+
+	s.roles = loaded
+	s.loadedAt = time.Now()
+	return loaded
+}
+
+// load 从数据库读取全部角色及其权限
+func (s *Service) load() (map[string]*roleEntry, error) {
+	var roles []models.Role
+	if err := s.db.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var bindings []models.RolePermission
+	if err := s.db.Order("role_name, permission").Find(&bindings).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*roleEntry, len(roles))
+	for _, r := range roles {
+		result[r.Name] = &roleEntry{dataScope: r.DataScope, permissions: []string{}}
+	}
+	for _, b := range bindings {
+		if e, ok := result[b.RoleName]; ok {
+			e.permissions = append(e.permissions, b.Permission)
+		}
+	}
+	return result, nil
+}
+
+func builtinRoles() map[string]*roleEntry {
+	result := make(map[string]*roleEntry, len(models.BuiltinRoles))
+	for _, name := range models.BuiltinRoles {
+		result[name] = &roleEntry{
+			dataScope:   models.DefaultRoleDataScope(name),
+			permissions: models.DefaultRolePermissions(name),
+		}
+	}
+	return result
+}
+
+// Seed 写入内置角色及其默认权限
+// 创建缺失的内置角色；已存在的内置角色补充尚未写入过的默认权限（如新版本增加的权限），
+// 已写入过又被管理员移除的权限不会恢复，其他修改保持不变
+func Seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range models.BuiltinRoles {
+			var count int64
+			if err := tx.Model(&models.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				role := models.Role{
+					Name:        name,
+					Description: models.BuiltinRoleDescriptions[name],
+					DataScope:   models.DefaultRoleDataScope(name),
+					Builtin:     true,
+				}
+				if err := tx.Create(&role).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := seedPermissions(tx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// seedPermissions 为内置角色写入尚未写入过的默认权限，并记录已写入的权限
+func seedPermissions(tx *gorm.DB, role string) error {
+	var seeded []string
+	if err := tx.Model(&models.RolePermissionSeed{}).Where("role_name = ?", role).Pluck("permission", &seeded).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(seeded))
+	for _, p := range seeded {
+		done[p] = true
+	}
+
+	var bindings []models.RolePermission
+	var seeds []models.RolePermissionSeed
+	for _, p := range models.DefaultRolePermissions(role) {
+		if done[p] {
+			continue
+		}
+		bindings = append(bindings, models.RolePermission{RoleName: role, Permission: p})
+		seeds = append(seeds, models.RolePermissionSeed{RoleName: role, Permission: p})
+	}
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bindings).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seeds).Error
+}
@@ -0,0 +1,214 @@
+// Package registry 设备变更服务
+//
+// 设备的注册和每一次修改都通过 Service 完成：变更与设备历史（操作者、客户端IP、交易哈希）
+// 在同一数据库事务中写入，并以设备版本号做乐观并发控制，避免并发修改互相覆盖。
+// 设备状态变为吊销或可疑时，在同一事务中使其跨域授权失效
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/grant"
+	"nono-system/backend/internal/models"
+)
+
+// ErrVersionConflict 设备在读取后已被其他请求修改
+var ErrVersionConflict = errors.New("Device has been modified by another request")
+
+// systemActor 没有登录用户时（如内部任务）历史记录中的操作者
+const systemActor = "system"
+
+// untrackedFields 由系统维护、不写入历史差异的字段
+var untrackedFields = map[string]bool{
+	"id":           true,
+	"version":      true,
+	"last_updated": true,
+	"created_at":   true,
+	"updated_at":   true,
+}
+
+// Actor 发起变更的操作者
+type Actor struct {
+	Username string
+	ClientIP string
+}
+
+// Change 对设备的一次修改
+type Change struct {
+	Action      string                 // 历史记录的操作类型，如 update、status_change、revoke、transfer
+	Description string                 // 历史记录的描述
+	TxHash      string                 // 区块链交易哈希（如果有）
+	Updates     map[string]interface{} // 列名 -> 新值
+
+	// ExpectedVersion 大于0时要求设备当前版本与之一致，用于 If-Match 等客户端指定的版本
+	ExpectedVersion int64
+}
+
+// Service 设备变更服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建设备变更服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Register 注册设备并记录 register 历史
+func (s *Service) Register(actor Actor, device *models.Device, description, txHash string) (*models.DeviceHistory, error) {
+	var history *models.DeviceHistory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(device).Error; err != nil {
+			return err
+		}
+		newValue, _ := json.Marshal(device)
+		history = newHistory(actor, device.DID, "register", "null", string(newValue), txHash, description)
+		return tx.Create(history).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Update 修改设备并记录历史，成功后 device 为修改后的最新状态
+// 没有实际变化的字段不写入历史；所有被跟踪的字段都未变化时不记录历史，返回的历史为 nil
+func (s *Service) Update(actor Actor, device *models.Device, change Change) (*models.DeviceHistory, error) {
+	var history *models.DeviceHistory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		history, err = s.UpdateTx(tx, actor, device, change)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// UpdateTx 在调用方的事务中修改设备并记录历史，用于需要和其他数据一起提交的变更
+// device 必须是修改前从数据库读取的状态，读取后被其他请求修改过时返回 ErrVersionConflict
+func (s *Service) UpdateTx(tx *gorm.DB, actor Actor, device *models.Device, change Change) (*models.DeviceHistory, error) {
+	if change.ExpectedVersion > 0 && change.ExpectedVersion != device.Version {
+		return nil, ErrVersionConflict
+	}
+
+	before := snapshot(device)
+
+	updates := make(map[string]interface{}, len(change.Updates)+2)
+	for column, value := range change.Updates {
+		updates[column] = value
+	}
+	updates["version"] = device.Version + 1
+	if _, ok := updates["last_updated"]; !ok {
+		updates["last_updated"] = time.Now()
+	}
+
+	// 条件更新，读取后被其他请求修改过时不更新任何行
+	result := tx.Model(&models.Device{}).
+		Where("id = ? AND version = ?", device.ID, device.Version).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrVersionConflict
+	}
+	if err := tx.First(device, device.ID).Error; err != nil {
+		return nil, err
+	}
+
+	oldValues, newValues := diff(before, snapshot(device))
+	if len(newValues) == 0 {
+		return nil, nil
+	}
+
+	// 设备被吊销或标记为可疑时，其跨域授权全部失效
+	if _, changed := newValues["status"]; changed && (device.Status == "revoked" || device.Status == "suspicious") {
+		if _, err := grant.RevokeDeviceTx(tx, device.DID, actorName(actor), "device status changed to "+device.Status); err != nil {
+			return nil, err
+		}
+	}
+	oldValue, _ := json.Marshal(oldValues)
+	newValue, _ := json.Marshal(newValues)
+	history := newHistory(actor, device.DID, change.Action, string(oldValue), string(newValue), change.TxHash, change.Description)
+	if err := tx.Create(history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Touch 只刷新设备的最后更新时间，不修改版本号也不记录历史，用于状态未变化的上报
+// 设备状态在读取后已被修改时不刷新，返回 ErrVersionConflict
+func (s *Service) Touch(device *models.Device, at time.Time) error {
+	result := s.db.Model(&models.Device{}).
+		Where("id = ? AND status = ?", device.ID, device.Status).
+		Update("last_updated", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	device.LastUpdated = at
+	return nil
+}
+
+// SetTxHash 为已记录的历史补充交易哈希，用于事务提交后才上链的变更
+func (s *Service) SetTxHash(history *models.DeviceHistory, txHash string) error {
+	if history == nil {
+		return nil
+	}
+	history.TxHash = txHash
+	return s.db.Model(&models.DeviceHistory{}).Where("id = ?", history.ID).Update("tx_hash", txHash).Error
+}
+
+// actorName 操作者用户名，没有登录用户时为 system
+func actorName(actor Actor) string {
+	if actor.Username == "" {
+		return systemActor
+	}
+	return actor.Username
+}
+
+func newHistory(actor Actor, did, action, oldValue, newValue, txHash, description string) *models.DeviceHistory {
+	return &models.DeviceHistory{
+		DeviceDID:   did,
+		Action:      action,
+		OldValue:    oldValue,
+		NewValue:    newValue,
+		ChangedBy:   actorName(actor),
+		ClientIP:    actor.ClientIP,
+		TxHash:      txHash,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// snapshot 设备各字段的 JSON 值，键为 JSON 字段名
+func snapshot(device *models.Device) map[string]json.RawMessage {
+	data, _ := json.Marshal(device)
+	fields := make(map[string]json.RawMessage)
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// diff 比较修改前后的字段，返回发生变化的字段的旧值和新值
+func diff(before, after map[string]json.RawMessage) (map[string]json.RawMessage, map[string]json.RawMessage) {
+	oldValues := make(map[string]json.RawMessage)
+	newValues := make(map[string]json.RawMessage)
+	for key, value := range after {
+		if untrackedFields[key] {
+			continue
+		}
+		if old, ok := before[key]; !ok || string(old) != string(value) {
+			oldValues[key] = before[key]
+			newValues[key] = value
+		}
+	}
+	return oldValues, newValues
+}
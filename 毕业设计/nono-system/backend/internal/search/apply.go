@@ -0,0 +1,233 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fieldKind 字段类型，决定支持的运算符和值的解析方式
+type fieldKind int
+
+const (
+	kindText fieldKind = iota
+	kindVersion
+	kindTime
+	kindBool
+)
+
+type field struct {
+	column string
+	kind   fieldKind
+}
+
+// fields 可在查询中使用的设备字段
+var fields = map[string]field{
+	"did":           {column: "devices.d_id", kind: kindText},
+	"device_id":     {column: "devices.device_id", kind: kindText},
+	"device_type":   {column: "devices.device_type", kind: kindText},
+	"manufacturer":  {column: "devices.manufacturer", kind: kindText},
+	"model":         {column: "devices.model", kind: kindText},
+	"firmware":      {column: "devices.firmware", kind: kindVersion},
+	"domain":        {column: "devices.domain", kind: kindText},
+	"status":        {column: "devices.status", kind: kindText},
+	"owner":         {column: "devices.owner", kind: kindText},
+	"is_public":     {column: "devices.is_public", kind: kindBool},
+	"registered_at": {column: "devices.registered_at", kind: kindTime},
+	"last_updated":  {column: "devices.last_updated", kind: kindTime},
+	"created_at":    {column: "devices.created_at", kind: kindTime},
+}
+
+// fieldAliases 字段名及其简写
+var fieldAliases = map[string]string{
+	"did":           "did",
+	"device_id":     "device_id",
+	"type":          "device_type",
+	"device_type":   "device_type",
+	"manufacturer":  "manufacturer",
+	"vendor":        "manufacturer",
+	"model":         "model",
+	"fw":            "firmware",
+	"firmware":      "firmware",
+	"domain":        "domain",
+	"status":        "status",
+	"owner":         "owner",
+	"public":        "is_public",
+	"is_public":     "is_public",
+	"registered":    "registered_at",
+	"registered_at": "registered_at",
+	"updated":       "last_updated",
+	"last_updated":  "last_updated",
+	"created":       "created_at",
+	"created_at":    "created_at",
+}
+
+// searchVector 全文检索向量，与 Migrate 创建的 GIN 索引表达式一致
+const searchVector = "to_tsvector('simple', coalesce(devices.d_id, '') || ' ' || coalesce(devices.device_id, '') || ' ' || " +
+	"coalesce(devices.manufacturer, '') || ' ' || coalesce(devices.model, '') || ' ' || coalesce(devices.firmware, ''))"
+
+// metadataExpr 元数据列（jsonb）
+const metadataExpr = "devices.metadata"
+
+// numericPattern 可以按数值比较的元数据值
+const numericPattern = `'^-{0,1}[0-9]+(\.[0-9]+){0,1}$'`
+
+// Apply 将查询条件应用到设备表查询
+func (q *Query) Apply(query *gorm.DB) (*gorm.DB, error) {
+	for _, t := range q.Terms {
+		var sql string
+		var arg interface{}
+		if t.Phrase {
+			sql, arg = searchVector+" @@ phraseto_tsquery('simple', ?)", t.Text
+		} else {
+			parts := lexemes(t.Text)
+			for i, p := range parts {
+				parts[i] = p + ":*"
+			}
+			sql, arg = searchVector+" @@ to_tsquery('simple', ?)", strings.Join(parts, " & ")
+		}
+		if t.Negate {
+			sql = "NOT (" + sql + ")"
+		}
+		query = query.Where(sql, arg)
+	}
+
+	for _, c := range q.Conditions {
+		sql, args, err := c.build()
+		if err != nil {
+			return nil, err
+		}
+		if c.Negate {
+			sql = "NOT COALESCE((" + sql + "), false)"
+		}
+		query = query.Where(sql, args...)
+	}
+	return query, nil
+}
+
+// build 生成字段条件的 SQL
+func (c Condition) build() (string, []interface{}, error) {
+	if c.Field == "metadata" {
+		return c.buildMetadata()
+	}
+
+	f := fields[c.Field]
+	switch f.kind {
+	case kindVersion:
+		op, err := compareOp(c.Op)
+		if err != nil {
+			return "", nil, err
+		}
+		return "nono_version_array(" + f.column + ") " + op + " nono_version_array(?)", []interface{}{c.Value}, nil
+
+	case kindTime:
+		return buildTime(f.column, c.Op, c.Value)
+
+	case kindBool:
+		b, err := strconv.ParseBool(c.Value)
+		if err != nil {
+			return "", nil, errorf("invalid boolean for %s: %s", c.Field, c.Value)
+		}
+		switch c.Op {
+		case ":", "=":
+			return f.column + " = ?", []interface{}{b}, nil
+		case "!=":
+			return f.column + " <> ?", []interface{}{b}, nil
+		}
+		return "", nil, errorf("operator %s is not supported for %s", c.Op, c.Field)
+	}
+
+	return buildText(f.column, c.Field, c.Op, c.Value)
+}
+
+// buildMetadata 生成元数据条件，如 metadata.location="plant-3"、metadata.temp>30
+func (c Condition) buildMetadata() (string, []interface{}, error) {
+	path := "'{" + strings.Join(c.Path, ",") + "}'"
+	name := "metadata." + strings.Join(c.Path, ".")
+
+	// metadata.location:* 表示存在该键
+	if c.Value == "*" && (c.Op == ":" || c.Op == "=") {
+		return metadataExpr + " #> " + path + " IS NOT NULL", nil, nil
+	}
+
+	expr := "(" + metadataExpr + " #>> " + path + ")"
+	switch c.Op {
+	case "<", "<=", ">", ">=":
+		n, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return "", nil, errorf("operator %s requires a number for %s", c.Op, name)
+		}
+		return "CASE WHEN " + expr + " ~ " + numericPattern + " THEN " + expr + "::numeric END " + c.Op + " ?",
+			[]interface{}{n}, nil
+	}
+	return buildText(expr, name, c.Op, c.Value)
+}
+
+// buildText 文本比较：不区分大小写，值中的 * 为通配符
+func buildText(expr, name, op, value string) (string, []interface{}, error) {
+	var sql string
+	var arg interface{}
+	if strings.Contains(value, "*") {
+		sql, arg = expr+` ILIKE ? ESCAPE '\'`, strings.ReplaceAll(likeEscaper.Replace(value), "*", "%")
+	} else {
+		sql, arg = "lower("+expr+") = lower(?)", value
+	}
+
+	switch op {
+	case ":", "=":
+		return sql, []interface{}{arg}, nil
+	case "!=":
+		return "NOT COALESCE((" + sql + "), false)", []interface{}{arg}, nil
+	}
+	return "", nil, errorf("operator %s is not supported for %s", op, name)
+}
+
+// buildTime 时间比较，值为日期（2006-01-02）或 RFC3339 时间
+// 只给日期时按整天比较，如 registered:2025-01-02 匹配当天注册的设备，registered>2025-01-02 从次日开始
+func buildTime(column, op, value string) (string, []interface{}, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		sqlOp, err := compareOp(op)
+		if err != nil {
+			return "", nil, err
+		}
+		return column + " " + sqlOp + " ?", []interface{}{t}, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return "", nil, errorf("invalid time: %s, expected 2006-01-02 or RFC3339", value)
+	}
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case ":", "=":
+		return column + " >= ? AND " + column + " < ?", []interface{}{day, next}, nil
+	case "!=":
+		return "NOT (" + column + " >= ? AND " + column + " < ?)", []interface{}{day, next}, nil
+	case "<":
+		return column + " < ?", []interface{}{day}, nil
+	case "<=":
+		return column + " < ?", []interface{}{next}, nil
+	case ">":
+		return column + " >= ?", []interface{}{next}, nil
+	default:
+		return column + " >= ?", []interface{}{day}, nil
+	}
+}
+
+// compareOp 将查询运算符转换为 SQL 运算符
+func compareOp(op string) (string, error) {
+	switch op {
+	case ":", "=":
+		return "=", nil
+	case "!=":
+		return "<>", nil
+	case "<", "<=", ">", ">=":
+		return op, nil
+	}
+	return "", errorf("invalid operator: %s", op)
+}
+
+// likeEscaper 转义 LIKE 模式中的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
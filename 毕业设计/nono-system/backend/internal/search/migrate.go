@@ -0,0 +1,29 @@
+package search
+
+import (
+	"gorm.io/gorm"
+)
+
+// migrations 搜索依赖的数据库函数和索引，可重复执行
+var migrations = []string{
+	// 提取版本号中的数字部分，如 v2.10.1-beta 为 {2,10,1}，用于按版本比较固件
+	`CREATE OR REPLACE FUNCTION nono_version_array(v text) RETURNS numeric[] AS $$
+	SELECT COALESCE(array_agg(m[1]::numeric ORDER BY n), '{}'::numeric[])
+	FROM regexp_matches(COALESCE(v, ''), '[0-9]+', 'g') WITH ORDINALITY AS t(m, n)
+$$ LANGUAGE sql IMMUTABLE`,
+
+	// 全文检索索引，表达式与 searchVector 一致
+	`CREATE INDEX IF NOT EXISTS idx_devices_search ON devices USING GIN (` +
+		`to_tsvector('simple', coalesce(d_id, '') || ' ' || coalesce(device_id, '') || ' ' || ` +
+		`coalesce(manufacturer, '') || ' ' || coalesce(model, '') || ' ' || coalesce(firmware, '')))`,
+}
+
+// Migrate 创建搜索依赖的数据库函数和全文检索索引
+func Migrate(db *gorm.DB) error {
+	for _, sql := range migrations {
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
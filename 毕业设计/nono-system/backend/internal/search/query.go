@@ -0,0 +1,202 @@
+// Package search 设备搜索：查询语言解析、全文检索和元数据过滤
+//
+// 查询由空格分隔的若干项组成，各项之间为“且”的关系：
+//
+//	status:active manufacturer:acme fw<2.0 metadata.location="plant-3" 温度传感器
+//
+// 形如 字段+运算符+值 的项为字段条件，运算符可以是 : = != < <= > >=；
+// 其他项为全文检索词，在 DID、设备ID、制造商、型号和固件版本中检索（按前缀匹配），
+// 用双引号括起的检索词按短语匹配。任意项前加 - 表示取反。
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 查询长度和项数上限
+const (
+	maxQueryLength = 1000
+	maxQueryTerms  = 32
+)
+
+// Error 查询语法或条件错误
+type Error struct {
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func errorf(format string, args ...interface{}) error {
+	return &Error{msg: fmt.Sprintf(format, args...)}
+}
+
+// Query 解析后的查询
+type Query struct {
+	Terms      []Term
+	Conditions []Condition
+}
+
+// Term 全文检索词
+type Term struct {
+	Text   string
+	Phrase bool // 按短语匹配
+	Negate bool
+}
+
+// Condition 字段条件
+type Condition struct {
+	Field  string   // 字段名（已规范化），元数据条件为 metadata
+	Path   []string // 元数据路径，如 metadata.location 为 [location]
+	Op     string   // 运算符：: = != < <= > >=
+	Value  string
+	Negate bool
+}
+
+// conditionPattern 字段条件：字段名后紧跟运算符
+var conditionPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.-]*)(!=|<=|>=|:|=|<|>)(.*)$`)
+
+// metadataKeyPattern 元数据路径中每一级的键名
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Parse 解析查询字符串
+func Parse(input string) (*Query, error) {
+	if len(input) > maxQueryLength {
+		return nil, errorf("query is too long (max %d characters)", maxQueryLength)
+	}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) > maxQueryTerms {
+		return nil, errorf("too many query terms (max %d)", maxQueryTerms)
+	}
+
+	q := &Query{}
+	for _, tok := range tokens {
+		negate := false
+		if len(tok) > 1 && tok[0] == '-' {
+			negate = true
+			tok = tok[1:]
+		}
+
+		if m := conditionPattern.FindStringSubmatch(tok); m != nil {
+			cond, err := parseCondition(m[1], m[2], m[3])
+			if err != nil {
+				return nil, err
+			}
+			cond.Negate = negate
+			q.Conditions = append(q.Conditions, cond)
+			continue
+		}
+
+		term := Term{Text: tok, Negate: negate}
+		if strings.HasPrefix(tok, `"`) {
+			text, err := unquote(tok)
+			if err != nil {
+				return nil, err
+			}
+			term.Text = text
+			term.Phrase = true
+		}
+		if len(lexemes(term.Text)) == 0 {
+			continue
+		}
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+// parseCondition 解析字段条件
+func parseCondition(key, op, raw string) (Condition, error) {
+	value := raw
+	if strings.HasPrefix(raw, `"`) {
+		v, err := unquote(raw)
+		if err != nil {
+			return Condition{}, err
+		}
+		value = v
+	}
+	if value == "" {
+		return Condition{}, errorf("missing value for %s", key)
+	}
+
+	// 字段名不区分大小写，元数据的键名区分大小写
+	lower := strings.ToLower(key)
+	if strings.HasPrefix(lower, "metadata.") {
+		path := strings.Split(key[len("metadata."):], ".")
+		for _, p := range path {
+			if !metadataKeyPattern.MatchString(p) {
+				return Condition{}, errorf("invalid metadata path: %s", key)
+			}
+		}
+		return Condition{Field: "metadata", Path: path, Op: op, Value: value}, nil
+	}
+
+	name, ok := fieldAliases[lower]
+	if !ok {
+		return Condition{}, errorf("unknown search field: %s", key)
+	}
+	// did:example:123 按完整的 DID 匹配
+	if name == "did" && op == ":" && strings.Contains(value, ":") && !strings.HasPrefix(raw, `"`) {
+		value = "did:" + value
+	}
+	return Condition{Field: name, Op: op, Value: value}, nil
+}
+
+// tokenize 按空白拆分查询，双引号内的空白不拆分
+func tokenize(input string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuote, escaped := false, false
+
+	for _, r := range input {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && unicode.IsSpace(r):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if inQuote {
+		return nil, errorf("unterminated quote in query")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+// unquote 去掉值两端的双引号并处理转义
+func unquote(s string) (string, error) {
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", errorf("invalid quoted value: %s", s)
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", errorf("invalid quoted value: %s", s)
+	}
+	return v, nil
+}
+
+// lexemes 将检索词拆分为只包含字母和数字的词元（小写）
+func lexemes(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -2,18 +2,36 @@ package server
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
+	"nono-system/backend/internal/apikey"
 	"nono-system/backend/internal/blockchain"
 	"nono-system/backend/internal/config"
+	"nono-system/backend/internal/database"
+	"nono-system/backend/internal/devicekey"
+	"nono-system/backend/internal/did"
+	"nono-system/backend/internal/grant"
 	"nono-system/backend/internal/handlers"
+	"nono-system/backend/internal/loginguard"
 	"nono-system/backend/internal/middleware"
+	"nono-system/backend/internal/metadata"
 	"nono-system/backend/internal/models"
+	"nono-system/backend/internal/rbac"
+	"nono-system/backend/internal/registry"
+	"nono-system/backend/internal/session"
+	"nono-system/backend/internal/token"
+	"nono-system/backend/internal/trust"
+	"nono-system/backend/pkg/vc"
 )
 
 // Server HTTP服务器
@@ -21,6 +39,17 @@ type Server struct {
 	config         *config.Config
 	db             *gorm.DB
 	blockchain     *blockchain.Client
+	tokens         *token.Manager
+	sessions       session.Store
+	apiKeys        *apikey.Service
+	loginGuard     *loginguard.Guard
+	roles          *rbac.Service
+	metadata       *metadata.Validator
+	devices        *registry.Service
+	deviceKeys     *devicekey.Service
+	credentials    *vc.Issuer
+	trustPolicies  *trust.Service
+	grants         *grant.Service
 	httpSrv        *http.Server
 }
 
@@ -45,10 +74,76 @@ func New(cfg *config.Config, db *gorm.DB) *Server {
 		log.Printf("Blockchain client initialized successfully")
 	}
 
+	// 初始化令牌管理器（生产模式必须配置签名密钥）
+	if cfg.Server.Mode == "release" && cfg.Auth.JWTSecret == "" && cfg.Auth.Ed25519PrivateKey == "" {
+		log.Fatalf("auth.jwt_secret or auth.ed25519_private_key is required in release mode")
+	}
+	tokens, err := token.NewManager(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to initialize token manager: %v", err)
+	}
+
+	// 会话存储或登录限流使用 Redis 时才建立连接
+	var rdb *redis.Client
+	if cfg.Auth.SessionStore == "redis" || cfg.Auth.LoginLimiter == "redis" {
+		rdb, err = database.NewRedis(cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to initialize redis: %v", err)
+		}
+	}
+
+	// 初始化会话存储（默认 Postgres，可选 Redis）
+	sessions, err := session.NewStore(cfg.Auth.SessionStore, db, rdb)
+	if err != nil {
+		log.Fatalf("Failed to initialize session store: %v", err)
+	}
+
+	// 初始化登录防暴力破解（默认进程内存，多实例部署使用 Redis）
+	guardStore, err := loginguard.NewStore(cfg.Auth.LoginLimiter, rdb)
+	if err != nil {
+		log.Fatalf("Failed to initialize login limiter: %v", err)
+	}
+	lockoutBase := time.Duration(cfg.Auth.LoginLockoutBase) * time.Second
+	lockoutMax := time.Duration(cfg.Auth.LoginLockoutMax) * time.Second
+	loginGuard := loginguard.New(guardStore,
+		loginguard.Policy{MaxAttempts: cfg.Auth.LoginMaxAttempts, BaseLockout: lockoutBase, MaxLockout: lockoutMax, Window: lockoutMax},
+		loginguard.Policy{MaxAttempts: cfg.Auth.LoginMaxAttemptsPerIP, BaseLockout: lockoutBase, MaxLockout: lockoutMax, Window: lockoutMax},
+	)
+
+	// 角色权限从数据库读取并缓存，RequirePermission 等通过 models.GetRolePermissions 使用
+	roles := rbac.NewService(db, time.Duration(cfg.Auth.RBACCacheTTL)*time.Second)
+	models.SetPermissionResolver(roles)
+
+	// 系统中还没有管理员时按配置创建首个管理员，公开注册不能创建管理员
+	admin, err := handlers.BootstrapAdmin(db, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword, cfg.Auth.AdminEmail)
+	if err != nil {
+		log.Fatalf("Failed to create initial administrator: %v", err)
+	}
+	if admin != nil {
+		log.Printf("Initial administrator %s created", admin.Username)
+	}
+
+	// 跨域认证凭证签发者
+	credentials, err := newCredentialIssuer(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to initialize credential issuer: %v", err)
+	}
+
 	srv := &Server{
 		config:     cfg,
 		db:         db,
 		blockchain: bcClient,
+		tokens:     tokens,
+		sessions:   sessions,
+		apiKeys:    apikey.NewService(db),
+		loginGuard: loginGuard,
+		roles:      roles,
+		metadata:   metadata.NewValidator(db, 0),
+		devices:    registry.NewService(db),
+		deviceKeys: devicekey.NewService(db, time.Duration(cfg.Auth.DeviceChallengeTTL)*time.Second),
+		credentials: credentials,
+		trustPolicies: trust.NewService(db),
+		grants:        grant.NewService(db, time.Duration(cfg.Auth.GrantTTL)*time.Minute),
 	}
 
 	// 注册路由
@@ -62,6 +157,31 @@ func New(cfg *config.Config, db *gorm.DB) *Server {
 	return srv
 }
 
+// newCredentialIssuer 根据配置创建凭证签发者，未配置私钥时随机生成（服务重启后已签发的凭证无法验证）
+func newCredentialIssuer(cfg config.AuthConfig) (*vc.Issuer, error) {
+	var key ed25519.PrivateKey
+	if cfg.CredentialPrivateKey == "" {
+		_, generated, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+		log.Printf("Warning: auth.credential_private_key not configured, using a random key (credentials will not survive restarts)")
+	} else {
+		seed, err := hex.DecodeString(cfg.CredentialPrivateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("auth.credential_private_key must be a %d-byte hex seed", ed25519.SeedSize)
+		}
+		key = ed25519.NewKeyFromSeed(seed)
+	}
+
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = "nono-system"
+	}
+	return vc.NewIssuer(did.IssuerDID(issuer), key), nil
+}
+
 // registerRoutes 注册路由
 func (s *Server) registerRoutes(router *gin.Engine) {
 	// 健康检查（无需认证）
@@ -71,17 +191,78 @@ func (s *Server) registerRoutes(router *gin.Engine) {
 	api := router.Group("/api/v1")
 	{
 		// 用户认证（无需认证）
-		api.POST("/users/register", handlers.RegisterUser(s.db))
-		api.POST("/users/login", handlers.Login(s.db))
+		api.POST("/users/register", handlers.RegisterUser(s.db, s.config.Auth.Registration))
+		api.POST("/users/login", handlers.Login(s.db, s.tokens, s.sessions, s.loginGuard, s.config.Auth.Require2FA))
+		api.POST("/users/login/2fa", handlers.LoginTwoFactor(s.db, s.tokens, s.sessions, s.loginGuard, s.config.Auth.Require2FA))
+		api.POST("/users/refresh", handlers.RefreshToken(s.db, s.tokens, s.sessions))
+
+		// DID 解析（无需认证）
+		api.GET("/did/:did", handlers.ResolveDID(s.db, s.config.Server.PublicURL, s.credentials))
+
+		// 跨域认证凭证的签发者公钥和在线验证（无需认证，供目标域使用）
+		api.GET("/credentials/issuer", handlers.GetCredentialIssuer(s.credentials))
+		api.POST("/credentials/verify", handlers.VerifyCredential(s.db, s.credentials))
 
 		// 需要认证的路由组
 		authenticated := api.Group("")
-		authenticated.Use(middleware.AuthMiddleware(s.db))
+		authenticated.Use(middleware.AuthMiddleware(s.db, s.tokens, s.sessions, s.apiKeys))
+		authenticated.Use(middleware.RequireTwoFactor(s.config.Auth.Require2FA))
 		authenticated.Use(middleware.FilterByDataPermission(s.db))
 		{
 			// 用户信息
-			authenticated.GET("/users/me", handlers.GetCurrentUser())
-			authenticated.GET("/users", middleware.RequireRole(models.RoleAdmin), handlers.ListUsers(s.db))
+			authenticated.GET("/users/me", handlers.GetCurrentUser(s.db))
+			authenticated.POST("/users/logout", handlers.Logout(s.sessions))
+			authenticated.PUT("/users/me/password", handlers.ChangeOwnPassword(s.db, s.sessions))
+
+			// 双因素认证
+			authenticated.POST("/users/me/2fa/enroll", handlers.EnrollTwoFactor(s.db, s.config.Auth.Issuer))
+			authenticated.POST("/users/me/2fa/verify", handlers.VerifyTwoFactor(s.db, s.tokens, s.sessions))
+			authenticated.DELETE("/users/me/2fa", handlers.DisableTwoFactor(s.db, s.config.Auth.Require2FA))
+			authenticated.POST("/users/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes(s.db))
+
+			// 用户管理（仅管理员）
+			users := authenticated.Group("/users")
+			users.Use(middleware.RequireRole(models.RoleAdmin))
+			{
+				users.POST("", handlers.CreateUser(s.db))
+				users.GET("", handlers.ListUsers(s.db))
+				users.POST("/invitations", handlers.CreateInvitation(s.db))
+				users.GET("/invitations", handlers.ListInvitations(s.db))
+				users.DELETE("/invitations/:id", handlers.RevokeInvitation(s.db))
+				users.PUT("/:id", handlers.UpdateUser(s.db, s.sessions))
+				users.POST("/:id/deactivate", handlers.DeactivateUser(s.db, s.sessions))
+				users.POST("/:id/activate", handlers.ActivateUser(s.db))
+				users.POST("/:id/reset-password", handlers.ResetPassword(s.db, s.sessions))
+				users.POST("/:id/unlock", handlers.UnlockUser(s.db, s.loginGuard))
+				users.POST("/:id/sessions/revoke", handlers.RevokeUserSessions(s.db, s.sessions))
+				users.POST("/:id/2fa/reset", handlers.ResetTwoFactor(s.db, s.sessions))
+				users.GET("/:id/domains", handlers.ListUserDomains(s.db))
+				users.POST("/:id/domains", handlers.GrantUserDomain(s.db))
+				users.PUT("/:id/domains/:domain", handlers.UpdateUserDomain(s.db))
+				users.DELETE("/:id/domains/:domain", handlers.RevokeUserDomain(s.db))
+			}
+
+			// 角色与权限管理（仅管理员）
+			roleGroup := authenticated.Group("/roles")
+			roleGroup.Use(middleware.RequireRole(models.RoleAdmin))
+			{
+				roleGroup.GET("", handlers.ListRoles(s.db))
+				roleGroup.GET("/permissions", handlers.ListPermissions())
+				roleGroup.POST("", handlers.CreateRole(s.db, s.roles))
+				roleGroup.PUT("/:name", handlers.UpdateRole(s.db, s.roles))
+				roleGroup.PUT("/:name/permissions", handlers.SetRolePermissions(s.db, s.roles))
+				roleGroup.DELETE("/:name", handlers.DeleteRole(s.db, s.roles))
+			}
+
+			// API密钥管理（仅管理员）
+			apiKeys := authenticated.Group("/api-keys")
+			apiKeys.Use(middleware.RequireRole(models.RoleAdmin))
+			{
+				apiKeys.POST("", handlers.CreateAPIKey(s.db))
+				apiKeys.GET("", handlers.ListAPIKeys(s.db))
+				apiKeys.POST("/:id/rotate", handlers.RotateAPIKey(s.db))
+				apiKeys.DELETE("/:id", handlers.RevokeAPIKey(s.db))
+			}
 
 			// 设备管理
 			devices := authenticated.Group("/devices")
@@ -89,10 +270,10 @@ func (s *Server) registerRoutes(router *gin.Engine) {
 				// 注册设备：管理员全权限，操作人员域级权限
 				devices.POST("", 
 					middleware.RequirePermission(models.PermDeviceRegister, models.PermDeviceRegisterDomain),
-					handlers.RegisterDevice(s.db))
+					handlers.RegisterDevice(s.db, s.metadata, s.devices))
 				devices.POST("/batch", 
 					middleware.RequirePermission(models.PermDeviceRegister, models.PermDeviceRegisterDomain),
-					handlers.BatchRegisterDevices(s.db))
+					handlers.BatchRegisterDevices(s.db, s.metadata, s.devices))
 				
 				// 查询设备：所有角色都可以查询（受数据权限限制）
 				devices.GET("", 
@@ -113,19 +294,99 @@ func (s *Server) registerRoutes(router *gin.Engine) {
 				devices.GET("/:did/history", 
 					middleware.RequirePermission(models.PermDeviceQuery),
 					handlers.GetDeviceHistory(s.db))
+				devices.GET("/:did/state", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.GetDeviceStateAt(s.db))
 				
-				// 更新设备状态：管理员和操作人员
+				// 更新设备状态：管理员、操作人员和预言机节点（预言机只能更新自己域的设备，且不能吊销）
 				devices.PUT("/:did/status", 
-					middleware.RequirePermission(models.PermDeviceUpdate),
-					handlers.UpdateDeviceStatus(s.db))
+					middleware.RequirePermission(models.PermDeviceUpdate, models.PermDeviceStatusUpdate),
+					handlers.UpdateDeviceStatus(s.db, s.devices))
 				devices.PUT("/batch/status", 
+					middleware.RequirePermission(models.PermDeviceUpdate, models.PermDeviceStatusUpdate),
+					handlers.BatchUpdateDeviceStatus(s.db, s.devices))
+
+				// 修改设备信息：需通过 If-Match 指定版本，DID、域等不可变字段不能修改
+				devices.PATCH("/:did", 
+					middleware.RequirePermission(models.PermDeviceUpdate),
+					handlers.UpdateDevice(s.db, s.metadata, s.devices))
+
+				// 设备跨域迁移：源域发起，目标域或管理员审批
+				devices.POST("/:did/transfers", 
+					middleware.RequirePermission(models.PermDeviceTransfer, models.PermDeviceUpdate),
+					handlers.RequestDeviceTransfer(s.db))
+				devices.GET("/:did/transfers", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.ListDeviceTransfers(s.db))
+
+				// 设备公钥和挑战-应答认证
+				devices.GET("/:did/keys", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.ListDeviceKeys(s.db, s.deviceKeys))
+				devices.POST("/:did/keys", 
 					middleware.RequirePermission(models.PermDeviceUpdate),
-					handlers.BatchUpdateDeviceStatus(s.db))
+					handlers.AddDeviceKey(s.db, s.deviceKeys))
+				devices.DELETE("/:did/keys/:key_id", 
+					middleware.RequirePermission(models.PermDeviceUpdate),
+					handlers.RevokeDeviceKey(s.db, s.deviceKeys))
+				devices.POST("/:did/challenges", 
+					middleware.RequirePermission(models.PermAuthRequest),
+					handlers.IssueDeviceChallenge(s.db, s.deviceKeys))
+				devices.POST("/:did/challenges/verify", 
+					middleware.RequirePermission(models.PermAuthRequest),
+					handlers.VerifyDeviceChallenge(s.db, s.deviceKeys))
+
+				// 修改设备公开状态和所有者
+				devices.PUT("/:did/visibility", 
+					middleware.RequirePermission(models.PermDeviceUpdate),
+					handlers.UpdateDeviceVisibility(s.db, s.devices))
+
+				// 预言机上报设备状态
+				devices.POST("/:did/status/report", 
+					middleware.RequirePermission(models.PermDeviceStatusReport),
+					handlers.ReportDeviceStatus(s.db, s.devices))
 				
 				// 吊销设备：仅管理员
 				devices.DELETE("/:did", 
 					middleware.RequirePermission(models.PermDeviceRevoke),
-					handlers.RevokeDevice(s.db))
+					handlers.RevokeDevice(s.db, s.devices))
+			}
+
+			// 设备迁移申请
+			transfers := authenticated.Group("/transfers")
+			{
+				transfers.GET("", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.ListDeviceTransfers(s.db))
+				transfers.GET("/:id", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.GetDeviceTransfer(s.db))
+				transfers.POST("/:id/approve", 
+					middleware.RequirePermission(models.PermDeviceTransfer, models.PermDeviceUpdate),
+					handlers.ApproveDeviceTransfer(s.db, s.devices, s.blockchain))
+				transfers.POST("/:id/reject", 
+					middleware.RequirePermission(models.PermDeviceTransfer, models.PermDeviceUpdate),
+					handlers.RejectDeviceTransfer(s.db))
+				transfers.POST("/:id/cancel", 
+					middleware.RequirePermission(models.PermDeviceTransfer, models.PermDeviceUpdate),
+					handlers.CancelDeviceTransfer(s.db))
+			}
+
+			// 设备类型元数据 Schema：查询需要设备查询权限，注册和删除仅管理员
+			deviceTypes := authenticated.Group("/device-types")
+			{
+				deviceTypes.GET("", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.ListDeviceTypeSchemas(s.db))
+				deviceTypes.GET("/:type/schema", 
+					middleware.RequirePermission(models.PermDeviceQuery),
+					handlers.GetDeviceTypeSchema(s.db))
+				deviceTypes.PUT("/:type/schema", 
+					middleware.RequireRole(models.RoleAdmin),
+					handlers.PutDeviceTypeSchema(s.db, s.metadata))
+				deviceTypes.DELETE("/:type/schema", 
+					middleware.RequireRole(models.RoleAdmin),
+					handlers.DeleteDeviceTypeSchema(s.db, s.metadata))
 			}
 
 			// 域管理（仅管理员）
@@ -145,13 +406,31 @@ func (s *Server) registerRoutes(router *gin.Engine) {
 					handlers.DeleteDomain(s.db))
 			}
 
+			// 目标域的跨域信任策略：管理员和目标域的操作人员管理，不要求域信息管理权限
+			trustPolicy := authenticated.Group("/domains/:name/trust-policy")
+			{
+				trustPolicy.GET("",
+					middleware.RequirePermission(models.PermTrustQuery, models.PermTrustManage),
+					handlers.GetTrustPolicy(s.trustPolicies))
+				trustPolicy.PUT("",
+					middleware.RequirePermission(models.PermTrustManage),
+					handlers.PutTrustPolicy(s.db, s.trustPolicies))
+				trustPolicy.DELETE("",
+					middleware.RequirePermission(models.PermTrustManage),
+					handlers.DeleteTrustPolicy(s.db, s.trustPolicies))
+				trustPolicy.POST("/evaluate",
+					middleware.RequirePermission(models.PermTrustQuery, models.PermTrustManage),
+					handlers.EvaluateTrustPolicy(s.db, s.trustPolicies))
+			}
+
 			// 跨域认证
 			auth := authenticated.Group("/auth")
 			{
 				// 发起跨域认证：管理员和操作人员
 				auth.POST("/cross-domain", 
 					middleware.RequirePermission(models.PermAuthRequest),
-					handlers.RequestCrossDomainAuth(s.db, s.blockchain))
+					handlers.RequestCrossDomainAuth(s.db, s.blockchain, s.deviceKeys, s.config.Auth.RequireDeviceSignature,
+						s.trustPolicies, s.grants, s.credentials, time.Duration(s.config.Auth.CredentialTTL)*time.Minute))
 				
 				// 同步前端上链的认证记录：管理员和操作人员
 				auth.POST("/sync", 
@@ -168,6 +447,51 @@ func (s *Server) registerRoutes(router *gin.Engine) {
 				auth.GET("/verify/:txHash", 
 					middleware.RequirePermission(models.PermAuthQuery, models.PermAuditQuery),
 					handlers.VerifyTransaction(s.blockchain))
+
+				// 跨域授权：查询和校验需要查询权限，撤销需要发起认证的权限
+				auth.GET("/grants/:did",
+					middleware.RequirePermission(models.PermAuthQuery, models.PermAuditQuery, models.PermAuthRequest),
+					handlers.ListAuthGrants(s.db, s.grants))
+				auth.GET("/grants/:did/check",
+					middleware.RequirePermission(models.PermAuthQuery, models.PermAuditQuery, models.PermAuthRequest),
+					handlers.CheckAuthGrant(s.db, s.grants))
+				auth.DELETE("/grants/:did",
+					middleware.RequirePermission(models.PermAuthRequest),
+					handlers.RevokeAuthGrants(s.db, s.grants))
+				auth.DELETE("/grants/:did/:id",
+					middleware.RequirePermission(models.PermAuthRequest),
+					handlers.RevokeAuthGrant(s.db, s.grants))
+			}
+
+			// 系统配置
+			sysConfig := authenticated.Group("/config")
+			{
+				sysConfig.GET("", 
+					middleware.RequirePermission(models.PermConfigQuery),
+					handlers.ListSystemConfigs(s.db))
+				sysConfig.GET("/:key", 
+					middleware.RequirePermission(models.PermConfigQuery),
+					handlers.GetSystemConfig(s.db))
+				sysConfig.POST("", 
+					middleware.RequirePermission(models.PermConfigCreate),
+					handlers.CreateSystemConfig(s.db))
+				sysConfig.PUT("/:key", 
+					middleware.RequirePermission(models.PermConfigUpdate),
+					handlers.UpdateSystemConfig(s.db))
+				sysConfig.DELETE("/:key", 
+					middleware.RequirePermission(models.PermConfigDelete),
+					handlers.DeleteSystemConfig(s.db))
+			}
+
+			// 审计日志（管理员和审计人员）
+			auditGroup := authenticated.Group("/audit")
+			{
+				auditGroup.GET("/logs", 
+					middleware.RequirePermission(models.PermAuditQuery),
+					handlers.ListAuditLogs(s.db))
+				auditGroup.GET("/stats", 
+					middleware.RequirePermission(models.PermAuditStats),
+					handlers.GetAuditStats(s.db))
 			}
 
 			// 统计和仪表板（管理员和审计人员）
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// PostgresStore 基于 user_sessions 表的会话存储
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore 创建 Postgres 会话存储
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Create 创建会话
+func (s *PostgresStore) Create(ctx context.Context, sess *models.UserSession) error {
+	return s.db.WithContext(ctx).Create(sess).Error
+}
+
+// IsActive 检查会话是否有效
+func (s *PostgresStore) IsActive(ctx context.Context, sessionID string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Get 返回有效的会话
+func (s *PostgresStore) Get(ctx context.Context, sessionID string) (*models.UserSession, error) {
+	var sess models.UserSession
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		First(&sess).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Rotate 轮换刷新令牌，条件更新保证同一个刷新令牌只能使用一次
+func (s *PostgresStore) Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, expiresAt time.Time) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND refresh_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, oldRefreshID, time.Now()).
+		Updates(map[string]interface{}{"refresh_id": newRefreshID, "expires_at": expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revoke 吊销单个会话
+func (s *PostgresStore) Revoke(ctx context.Context, sessionID, reason string) error {
+	return s.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+// RevokeAllForUser 吊销用户的所有会话
+func (s *PostgresStore) RevokeAllForUser(ctx context.Context, userID uint, reason string) error {
+	return s.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
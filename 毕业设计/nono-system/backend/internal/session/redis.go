@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"nono-system/backend/internal/models"
+)
+
+// RedisStore 基于 Redis 的会话存储，适用于多实例部署
+// 会话保存为哈希（用户ID、当前刷新令牌ID、创建时间），键随令牌过期自动删除，吊销即删除键
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisStore 创建 Redis 会话存储
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+func sessionKey(sessionID string) string {
+	return "nono:session:v2:" + sessionID
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("nono:user_sessions:%d", userID)
+}
+
+// rotateScript 当前刷新令牌ID匹配时替换并设置过期时间，用户会话索引的过期时间只延长不缩短
+var rotateScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'refresh_id') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'refresh_id', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+local index = 'nono:user_sessions:' .. redis.call('HGET', KEYS[1], 'user_id')
+if redis.call('PTTL', index) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', index, ARGV[3])
+end
+return 1
+`)
+
+// Create 创建会话
+func (s *RedisStore) Create(ctx context.Context, sess *models.UserSession) error {
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session already expired")
+	}
+	createdAt := sess.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, sessionKey(sess.ID),
+		"user_id", strconv.FormatUint(uint64(sess.UserID), 10),
+		"refresh_id", sess.RefreshID,
+		"created_at", createdAt.Unix())
+	pipe.Expire(ctx, sessionKey(sess.ID), ttl)
+	pipe.SAdd(ctx, userSessionsKey(sess.UserID), sess.ID)
+	// 新会话的有效期不短于已有会话，索引集合的过期时间跟随最新的会话即可
+	pipe.Expire(ctx, userSessionsKey(sess.UserID), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IsActive 检查会话是否有效
+func (s *RedisStore) IsActive(ctx context.Context, sessionID string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, sessionKey(sessionID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Get 返回有效的会话
+func (s *RedisStore) Get(ctx context.Context, sessionID string) (*models.UserSession, error) {
+	pipe := s.rdb.Pipeline()
+	fields := pipe.HGetAll(ctx, sessionKey(sessionID))
+	ttl := pipe.PTTL(ctx, sessionKey(sessionID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	values := fields.Val()
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	userID, err := strconv.ParseUint(values["user_id"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", sessionID, err)
+	}
+	createdAt, err := strconv.ParseInt(values["created_at"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", sessionID, err)
+	}
+	return &models.UserSession{
+		ID:        sessionID,
+		UserID:    uint(userID),
+		RefreshID: values["refresh_id"],
+		CreatedAt: time.Unix(createdAt, 0),
+		ExpiresAt: time.Now().Add(ttl.Val()),
+	}, nil
+}
+
+// Rotate 轮换刷新令牌，脚本保证比较和替换的原子性
+func (s *RedisStore) Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	n, err := rotateScript.Run(ctx, s.rdb, []string{sessionKey(sessionID)},
+		oldRefreshID, newRefreshID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Revoke 吊销单个会话
+func (s *RedisStore) Revoke(ctx context.Context, sessionID, reason string) error {
+	userID, err := s.rdb.HGet(ctx, sessionKey(sessionID), "user_id").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.SRem(ctx, "nono:user_sessions:"+userID, sessionID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAllForUser 吊销用户的所有会话
+func (s *RedisStore) RevokeAllForUser(ctx context.Context, userID uint, reason string) error {
+	ids, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	keys = append(keys, userSessionsKey(userID))
+	return s.rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// 吊销原因
+const (
+	ReasonLogout      = "logout"
+	ReasonAdmin       = "admin"
+	ReasonDisabled    = "disabled"
+	ReasonRoleChanged = "role_changed"
+	// ReasonRefreshReuse 已轮换的刷新令牌被再次使用，令牌可能已泄露
+	ReasonRefreshReuse = "refresh_reuse"
+)
+
+// Store 服务端会话存储
+type Store interface {
+	// Create 创建会话
+	Create(ctx context.Context, s *models.UserSession) error
+	// IsActive 检查会话是否存在、未过期且未被吊销
+	IsActive(ctx context.Context, sessionID string) (bool, error)
+	// Get 返回有效的会话（包括当前刷新令牌ID和创建时间），不存在、已过期或已吊销时返回 nil
+	Get(ctx context.Context, sessionID string) (*models.UserSession, error)
+	// Rotate 轮换刷新令牌：会话当前的刷新令牌ID为 oldRefreshID 时替换为 newRefreshID，并将有效期设为 expiresAt。
+	// 返回 false 表示会话已失效或 oldRefreshID 已被轮换（刷新令牌被重复使用）
+	Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, expiresAt time.Time) (bool, error)
+	// Revoke 吊销单个会话
+	Revoke(ctx context.Context, sessionID, reason string) error
+	// RevokeAllForUser 吊销用户的所有会话（强制下线）
+	RevokeAllForUser(ctx context.Context, userID uint, reason string) error
+}
+
+// NewStore 根据配置创建会话存储，backend 为 "redis" 时使用 Redis，否则使用 Postgres
+func NewStore(backend string, db *gorm.DB, rdb *redis.Client) (Store, error) {
+	switch backend {
+	case "", "postgres":
+		return NewPostgresStore(db), nil
+	case "redis":
+		if rdb == nil {
+			return nil, fmt.Errorf("redis session store requires a redis client")
+		}
+		return NewRedisStore(rdb), nil
+	default:
+		return nil, fmt.Errorf("unsupported session store: %s", backend)
+	}
+}
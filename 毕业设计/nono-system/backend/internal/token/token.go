@@ -0,0 +1,280 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"nono-system/backend/internal/config"
+	"nono-system/backend/internal/models"
+)
+
+// 令牌类型
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	TypeMFA     = "mfa" // 密码验证通过、等待二次验证的临时令牌
+)
+
+// MFATokenTTL 二次验证临时令牌有效期
+const MFATokenTTL = 5 * time.Minute
+
+var (
+	// ErrInvalidToken 令牌无效（签名错误、格式错误、签发者不匹配等）
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken 令牌已过期
+	ErrExpiredToken = errors.New("token expired")
+	// ErrWrongTokenType 令牌类型不匹配（例如用刷新令牌访问接口）
+	ErrWrongTokenType = errors.New("wrong token type")
+	// ErrSessionLifetimeExceeded 会话已超过最长有效期，需要重新登录
+	ErrSessionLifetimeExceeded = errors.New("session lifetime exceeded")
+)
+
+// Claims JWT 声明
+type Claims struct {
+	UserID    uint   `json:"uid"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Domain    string `json:"domain"`
+	TokenType string `json:"typ"`
+	SessionID string `json:"sid"`           // 服务端会话ID，用于注销和吊销
+	MFA       bool   `json:"mfa,omitempty"` // 本次会话是否完成了二次验证
+	jwt.RegisteredClaims
+}
+
+// Pair 访问令牌与刷新令牌
+type Pair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"` // 访问令牌剩余有效期（秒）
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	RefreshID        string    `json:"-"` // 刷新令牌ID（jti），保存在会话中用于轮换和重放检测
+}
+
+// Manager 令牌签发与验证
+type Manager struct {
+	issuer     string
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	maxSession time.Duration
+}
+
+// NewManager 根据配置创建令牌管理器
+func NewManager(cfg config.AuthConfig) (*Manager, error) {
+	m := &Manager{
+		issuer:     cfg.Issuer,
+		accessTTL:  time.Duration(cfg.AccessTokenTTL) * time.Minute,
+		refreshTTL: time.Duration(cfg.RefreshTokenTTL) * time.Hour,
+		maxSession: time.Duration(cfg.SessionMaxLifetime) * time.Hour,
+	}
+	if m.issuer == "" {
+		m.issuer = "nono-system"
+	}
+	if m.accessTTL <= 0 {
+		m.accessTTL = 30 * time.Minute
+	}
+	if m.refreshTTL <= 0 {
+		m.refreshTTL = 7 * 24 * time.Hour
+	}
+	if m.maxSession <= 0 {
+		m.maxSession = 30 * 24 * time.Hour
+	}
+
+	switch cfg.SigningMethod {
+	case "", "HS256":
+		secret := []byte(cfg.JWTSecret)
+		if len(secret) == 0 {
+			// 未配置密钥时生成随机密钥，服务重启后已签发的令牌全部失效
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, fmt.Errorf("failed to generate jwt secret: %w", err)
+			}
+			log.Printf("Warning: auth.jwt_secret not configured, using a random secret (tokens will not survive restarts)")
+		} else if len(secret) < 32 {
+			return nil, fmt.Errorf("auth.jwt_secret must be at least 32 bytes")
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = secret
+		m.verifyKey = secret
+	case "EdDSA":
+		seed, err := hex.DecodeString(cfg.Ed25519PrivateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("auth.ed25519_private_key must be a %d-byte hex seed", ed25519.SeedSize)
+		}
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		m.method = jwt.SigningMethodEdDSA
+		m.signKey = privateKey
+		m.verifyKey = privateKey.Public()
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %s", cfg.SigningMethod)
+	}
+
+	return m, nil
+}
+
+// AccessTTL 访问令牌有效期
+func (m *Manager) AccessTTL() time.Duration {
+	return m.accessTTL
+}
+
+// RefreshTTL 刷新令牌有效期
+func (m *Manager) RefreshTTL() time.Duration {
+	return m.refreshTTL
+}
+
+// MaxSessionLifetime 会话最长有效期，从登录时起算，刷新令牌不能延长到该时间之后
+func (m *Manager) MaxSessionLifetime() time.Duration {
+	return m.maxSession
+}
+
+// NewSessionID 生成新的会话ID
+func NewSessionID() (string, error) {
+	return randomID()
+}
+
+// IssuePair 为用户会话签发访问令牌和刷新令牌，mfa 表示会话是否完成了二次验证
+// sessionStart 为会话创建时间，令牌有效期不超过会话的最长有效期，超过时返回 ErrSessionLifetimeExceeded
+func (m *Manager) IssuePair(user *models.User, sessionID string, mfa bool, sessionStart time.Time) (*Pair, error) {
+	now := time.Now()
+	deadline := sessionStart.Add(m.maxSession)
+	if !deadline.After(now) {
+		return nil, ErrSessionLifetimeExceeded
+	}
+	refreshExp := now.Add(m.refreshTTL)
+	if refreshExp.After(deadline) {
+		refreshExp = deadline
+	}
+	accessExp := now.Add(m.accessTTL)
+	if accessExp.After(refreshExp) {
+		accessExp = refreshExp
+	}
+
+	access, _, err := m.sign(user, sessionID, TypeAccess, mfa, now, accessExp)
+	if err != nil {
+		return nil, err
+	}
+	refresh, refreshID, err := m.sign(user, sessionID, TypeRefresh, mfa, now, refreshExp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(m.accessTTL.Seconds()),
+		AccessExpiresAt:  accessExp,
+		RefreshExpiresAt: refreshExp,
+		RefreshID:        refreshID,
+	}, nil
+}
+
+// IssueMFAToken 签发二次验证临时令牌，仅能用于提交验证码
+func (m *Manager) IssueMFAToken(user *models.User) (string, error) {
+	now := time.Now()
+	signed, _, err := m.sign(user, "", TypeMFA, false, now, now.Add(MFATokenTTL))
+	return signed, err
+}
+
+// ParseMFA 验证二次验证临时令牌
+func (m *Manager) ParseMFA(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TypeMFA)
+}
+
+// ParseAccess 验证访问令牌
+func (m *Manager) ParseAccess(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TypeAccess)
+}
+
+// ParseRefresh 验证刷新令牌
+func (m *Manager) ParseRefresh(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TypeRefresh)
+}
+
+// sign 签名生成令牌，同时返回令牌ID（jti）
+func (m *Manager) sign(user *models.User, sessionID, tokenType string, mfa bool, now, expiresAt time.Time) (string, string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Domain:    user.Domain,
+		TokenType: tokenType,
+		SessionID: sessionID,
+		MFA:       mfa,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    m.issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, jti, nil
+}
+
+// parse 验证签名、签发者、有效期和令牌类型
+func (m *Manager) parse(tokenString, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims.TokenType != tokenType {
+		return nil, ErrWrongTokenType
+	}
+
+	return claims, nil
+}
+
+// randomID 生成随机ID（128位，hex编码）
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// User 根据声明构造用户对象（不查询数据库）
+func (c *Claims) User() *models.User {
+	return &models.User{
+		ID:       c.UserID,
+		Username: c.Username,
+		Role:     c.Role,
+		Domain:   c.Domain,
+		IsActive: true,
+	}
+}
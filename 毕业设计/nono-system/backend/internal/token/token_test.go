@@ -0,0 +1,84 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nono-system/backend/internal/config"
+	"nono-system/backend/internal/models"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(config.AuthConfig{
+		JWTSecret:          "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:     30,
+		RefreshTokenTTL:    168,
+		SessionMaxLifetime: 720,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestIssuePairSessionLifetime(t *testing.T) {
+	m := newTestManager(t)
+	user := &models.User{ID: 1, Username: "alice", Role: models.RoleUser}
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		sessionStart time.Time
+		wantErr      error
+		wantRefresh  time.Time // 刷新令牌过期时间
+	}{
+		{"new session", now, nil, now.Add(m.RefreshTTL())},
+		{"capped by max lifetime", now.Add(-m.MaxSessionLifetime() + time.Hour), nil, now.Add(time.Hour)},
+		{"lifetime exceeded", now.Add(-m.MaxSessionLifetime()), ErrSessionLifetimeExceeded, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := m.IssuePair(user, "sid", false, tt.sessionStart)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if d := pair.RefreshExpiresAt.Sub(tt.wantRefresh); d < -time.Second || d > time.Second {
+				t.Errorf("refresh expires at %v, want %v", pair.RefreshExpiresAt, tt.wantRefresh)
+			}
+			if pair.AccessExpiresAt.After(pair.RefreshExpiresAt) {
+				t.Errorf("access token outlives refresh token")
+			}
+
+			claims, err := m.ParseRefresh(pair.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.ID != pair.RefreshID {
+				t.Errorf("refresh jti = %q, want %q", claims.ID, pair.RefreshID)
+			}
+		})
+	}
+}
+
+func TestIssuePairRotatesRefreshID(t *testing.T) {
+	m := newTestManager(t)
+	user := &models.User{ID: 1, Username: "alice", Role: models.RoleUser}
+	start := time.Now()
+
+	first, err := m.IssuePair(user, "sid", false, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.IssuePair(user, "sid", false, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RefreshID == "" || first.RefreshID == second.RefreshID {
+		t.Errorf("refresh IDs must be unique per pair: %q, %q", first.RefreshID, second.RefreshID)
+	}
+}
@@ -0,0 +1,380 @@
+// Package trust 目标域的跨域信任策略
+//
+// 每个目标域可以配置一份策略：按优先级排列的规则和默认处理方式。跨域认证时按优先级依次匹配规则，
+// 规则的条件（源域、设备类型、固件版本范围、时间窗口）全部满足时匹配，由第一条匹配的规则决定
+// 允许或拒绝；没有规则匹配时使用策略的默认处理方式。目标域没有配置策略时不做限制。
+package trust
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"nono-system/backend/internal/models"
+)
+
+// 决策来源
+const (
+	SourceRule     = "rule"      // 由匹配的规则决定
+	SourceDefault  = "default"   // 没有规则匹配，使用默认处理方式
+	SourceNoPolicy = "no_policy" // 目标域没有配置策略
+)
+
+// weekdays 时间窗口中星期的写法
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Decision 策略评估结果
+type Decision struct {
+	Allowed  bool   `json:"allowed"`
+	Effect   string `json:"effect"` // allow 或 deny
+	Source   string `json:"source"` // rule、default 或 no_policy
+	PolicyID *uint  `json:"policy_id,omitempty"`
+	RuleID   *uint  `json:"rule_id,omitempty"`
+	RuleName string `json:"rule_name,omitempty"`
+	Reason   string `json:"reason"`
+	// MaxSession 授权的最长有效时间，0 表示不限制（使用系统默认值）
+	MaxSession        time.Duration `json:"-"`
+	MaxSessionMinutes int           `json:"max_session_minutes,omitempty"`
+}
+
+// Validate 校验并规范化策略：处理方式转为小写、补全时区、规则按优先级排序
+func Validate(policy *models.TrustPolicy) error {
+	policy.DefaultAction = strings.ToLower(policy.DefaultAction)
+	if policy.DefaultAction == "" {
+		policy.DefaultAction = models.TrustDeny
+	}
+	if policy.DefaultAction != models.TrustAllow && policy.DefaultAction != models.TrustDeny {
+		return errors.New("default_action must be allow or deny")
+	}
+	if policy.Timezone == "" {
+		policy.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(policy.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", policy.Timezone)
+	}
+
+	names := make(map[string]bool, len(policy.Rules))
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rules[%d]: duplicate rule name %q", i, rule.Name)
+		}
+		names[rule.Name] = true
+
+		rule.Effect = strings.ToLower(rule.Effect)
+		if rule.Effect != models.TrustAllow && rule.Effect != models.TrustDeny {
+			return fmt.Errorf("rules[%d]: effect must be allow or deny", i)
+		}
+		if len(rule.SourceDomains) == 0 {
+			return fmt.Errorf("rules[%d]: source_domains is required, use [\"*\"] to match any domain", i)
+		}
+		if rule.MaxSessionMinutes < 0 {
+			return fmt.Errorf("rules[%d]: max_session_minutes must not be negative", i)
+		}
+		if rule.MinFirmware != "" && rule.MaxFirmware != "" && compareVersions(rule.MinFirmware, rule.MaxFirmware) > 0 {
+			return fmt.Errorf("rules[%d]: min_firmware is greater than max_firmware", i)
+		}
+		for j, w := range rule.TimeWindows {
+			if _, err := parseClock(w.Start); err != nil {
+				return fmt.Errorf("rules[%d].time_windows[%d]: invalid start %q, expected HH:MM", i, j, w.Start)
+			}
+			if _, err := parseClock(w.End); err != nil {
+				return fmt.Errorf("rules[%d].time_windows[%d]: invalid end %q, expected HH:MM", i, j, w.End)
+			}
+			for k, day := range w.Days {
+				day = strings.ToLower(day)
+				if _, ok := weekdays[day]; !ok {
+					return fmt.Errorf("rules[%d].time_windows[%d]: invalid day %q", i, j, w.Days[k])
+				}
+				w.Days[k] = day
+			}
+		}
+		// 未指定优先级的规则按出现顺序排列
+		if rule.Priority == 0 {
+			rule.Priority = (i + 1) * 10
+		}
+	}
+
+	sort.SliceStable(policy.Rules, func(i, j int) bool { return policy.Rules[i].Priority < policy.Rules[j].Priority })
+	return nil
+}
+
+// Evaluate 评估来自 sourceDomain 的设备在 now 时能否访问策略所属的目标域，policy 为 nil 时允许
+func Evaluate(policy *models.TrustPolicy, device *models.Device, sourceDomain string, now time.Time) Decision {
+	if policy == nil {
+		return Decision{Allowed: true, Effect: models.TrustAllow, Source: SourceNoPolicy, Reason: "target domain has no trust policy"}
+	}
+
+	loc, err := time.LoadLocation(policy.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+
+	policyID := policy.ID
+	rules := append([]models.TrustRule(nil), policy.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+	for _, rule := range rules {
+		if !matches(&rule, device, sourceDomain, local) {
+			continue
+		}
+		ruleID := rule.ID
+		d := Decision{
+			Allowed:  rule.Effect == models.TrustAllow,
+			Effect:   rule.Effect,
+			Source:   SourceRule,
+			PolicyID: &policyID,
+			RuleID:   &ruleID,
+			RuleName: rule.Name,
+			Reason:   fmt.Sprintf("matched rule %q", rule.Name),
+		}
+		if d.Allowed && rule.MaxSessionMinutes > 0 {
+			d.MaxSessionMinutes = rule.MaxSessionMinutes
+			d.MaxSession = time.Duration(rule.MaxSessionMinutes) * time.Minute
+		}
+		return d
+	}
+
+	return Decision{
+		Allowed:  policy.DefaultAction == models.TrustAllow,
+		Effect:   policy.DefaultAction,
+		Source:   SourceDefault,
+		PolicyID: &policyID,
+		Reason:   "no rule matched, default action " + policy.DefaultAction,
+	}
+}
+
+// matches 规则的所有条件是否都满足
+func matches(rule *models.TrustRule, device *models.Device, sourceDomain string, local time.Time) bool {
+	if !containsOrWildcard(rule.SourceDomains, sourceDomain) {
+		return false
+	}
+	if len(rule.DeviceTypes) > 0 && !containsOrWildcard(rule.DeviceTypes, device.DeviceType) {
+		return false
+	}
+	if rule.MinFirmware != "" || rule.MaxFirmware != "" {
+		if device.Firmware == "" {
+			return false
+		}
+		if rule.MinFirmware != "" && compareVersions(device.Firmware, rule.MinFirmware) < 0 {
+			return false
+		}
+		if rule.MaxFirmware != "" && compareVersions(device.Firmware, rule.MaxFirmware) > 0 {
+			return false
+		}
+	}
+	if len(rule.TimeWindows) > 0 && !inAnyWindow(rule.TimeWindows, local) {
+		return false
+	}
+	return true
+}
+
+func containsOrWildcard(values []string, v string) bool {
+	for _, s := range values {
+		if s == "*" || s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// inAnyWindow 时间是否落在任一时间窗口内，跨越午夜的窗口按开始的那一天判断星期
+func inAnyWindow(windows []models.TimeWindow, local time.Time) bool {
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range windows {
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		day := local.Weekday()
+		var in bool
+		switch {
+		case start <= end:
+			in = minute >= start && minute < end
+		case minute >= start:
+			in = true
+		case minute < end:
+			// 跨越午夜的窗口，当前处于后半段，属于前一天开始的窗口
+			in = true
+			day = (day + 6) % 7
+		}
+		if in && onDay(w.Days, day) {
+			return true
+		}
+	}
+	return false
+}
+
+func onDay(days []string, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 解析 HH:MM，返回当天的分钟数，24:00 表示一天结束
+func parseClock(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, errors.New("expected HH:MM")
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.New("expected HH:MM")
+	}
+	return h*60 + m, nil
+}
+
+// compareVersions 比较版本号，如 1.2.10 > 1.2.9；可带 v 前缀，数字段按数值比较，其他段按字符串比较
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		v = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v), "v"), "V")
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '+' || r == '_' })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		sa, sb := "0", "0"
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		na, errA := strconv.Atoi(sa)
+		nb, errB := strconv.Atoi(sb)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case sa != sb:
+			if sa < sb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Service 信任策略的存储
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建信任策略服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Get 目标域的策略，没有配置时返回 nil
+func (s *Service) Get(targetDomain string) (*models.TrustPolicy, error) {
+	var policy models.TrustPolicy
+	err := s.db.Preload("Rules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("priority, id")
+	}).Where("target_domain = ?", targetDomain).First(&policy).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Put 创建或整体替换目标域的策略，policy 须已通过 Validate
+func (s *Service) Put(targetDomain string, policy *models.TrustPolicy, updatedBy string) (*models.TrustPolicy, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.TrustPolicy
+		err := tx.Where("target_domain = ?", targetDomain).First(&existing).Error
+		switch {
+		case err == nil:
+			if err := tx.Where("policy_id = ?", existing.ID).Delete(&models.TrustRule{}).Error; err != nil {
+				return err
+			}
+			policy.ID = existing.ID
+			policy.CreatedAt = existing.CreatedAt
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		policy.TargetDomain = targetDomain
+		policy.UpdatedBy = updatedBy
+		rules := policy.Rules
+		policy.Rules = nil
+		if err := tx.Save(policy).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			rules[i].ID = 0
+			rules[i].PolicyID = policy.ID
+		}
+		if len(rules) > 0 {
+			if err := tx.Create(&rules).Error; err != nil {
+				return err
+			}
+		}
+		policy.Rules = rules
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Delete 删除目标域的策略，删除后不再限制跨域认证
+func (s *Service) Delete(targetDomain string) (bool, error) {
+	var deleted bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = DeleteTx(tx, targetDomain)
+		return err
+	})
+	return deleted, err
+}
+
+// DeleteTx 在调用方的事务中删除目标域的策略，用于删除域
+func DeleteTx(tx *gorm.DB, targetDomain string) (bool, error) {
+	var policy models.TrustPolicy
+	if err := tx.Where("target_domain = ?", targetDomain).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := tx.Where("policy_id = ?", policy.ID).Delete(&models.TrustRule{}).Error; err != nil {
+		return false, err
+	}
+	return true, tx.Delete(&policy).Error
+}
+
+// Decide 评估跨域认证请求
+func (s *Service) Decide(targetDomain string, device *models.Device, sourceDomain string, now time.Time) (Decision, error) {
+	policy, err := s.Get(targetDomain)
+	if err != nil {
+		return Decision{}, err
+	}
+	return Evaluate(policy, device, sourceDomain, now), nil
+}
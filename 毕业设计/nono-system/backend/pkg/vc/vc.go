@@ -0,0 +1,252 @@
+// Package vc 跨域认证结果的可验证凭证（JWT-VC）
+//
+// 跨域认证成功后，后端签发一份 Ed25519 签名、有时效的凭证，绑定设备 DID、源域、目标域和链上交易哈希。
+// 目标域服务可以嵌入本包离线验证凭证，无需访问后端：
+//
+//	key, _ := vc.ParseJWK(jwkJSON) // GET /api/v1/credentials/issuer 返回的 jwk
+//	verifier := vc.NewVerifier("did:nono:issuer:nono-system", key)
+//	cred, err := verifier.Verify(token, vc.VerifyOptions{Audience: "factory-2"})
+//
+// 离线验证只能检查签名、有效期和目标域；凭证签发后授权是否被撤销（如设备被吊销或迁移），
+// 需调用后端的 POST /api/v1/credentials/verify。
+//
+// 本包只依赖标准库和 github.com/golang-jwt/jwt/v5。
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 凭证常量
+const (
+	ContextV1      = "https://www.w3.org/2018/credentials/v1"
+	TypeCredential = "VerifiableCredential"
+	// TypeCrossDomainAuth 跨域认证凭证的类型
+	TypeCrossDomainAuth = "CrossDomainAuthorizationCredential"
+	// KeyID 签名公钥在签发者 DID 下的片段
+	KeyID = "credential-key-1"
+)
+
+// DefaultLeeway 验证有效期时允许的时钟偏差
+const DefaultLeeway = 30 * time.Second
+
+var (
+	// ErrInvalidCredential 凭证格式错误、签名错误或内容不一致
+	ErrInvalidCredential = errors.New("invalid credential")
+	// ErrExpiredCredential 凭证已过期或尚未生效
+	ErrExpiredCredential = errors.New("credential expired")
+	// ErrWrongAudience 凭证不是签发给该目标域的
+	ErrWrongAudience = errors.New("credential issued for a different target domain")
+)
+
+// Subject 凭证主体：一次跨域认证的结果
+type Subject struct {
+	ID           string `json:"id"` // 设备 DID
+	SourceDomain string `json:"sourceDomain"`
+	TargetDomain string `json:"targetDomain"`
+	Authorized   bool   `json:"authorized"`
+	TxHash       string `json:"txHash,omitempty"`      // 链上交易哈希，区块链未连接时为空
+	RecordID     uint   `json:"recordId,omitempty"`    // 后端认证记录ID
+	DeviceKeyID  string `json:"deviceKeyId,omitempty"` // 设备签名验证使用的公钥
+}
+
+// Credential W3C 可验证凭证（数据模型 1.1）
+type Credential struct {
+	Context           []string  `json:"@context"`
+	ID                string    `json:"id"`
+	Type              []string  `json:"type"`
+	Issuer            string    `json:"issuer"`
+	IssuanceDate      time.Time `json:"issuanceDate"`
+	ExpirationDate    time.Time `json:"expirationDate"`
+	CredentialSubject Subject   `json:"credentialSubject"`
+}
+
+// claims JWT-VC 声明：iss 为签发者，sub 为设备 DID，aud 为目标域，jti 为凭证ID
+type claims struct {
+	VC Credential `json:"vc"`
+	jwt.RegisteredClaims
+}
+
+// Issuer 凭证签发者
+type Issuer struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+// NewIssuer 创建签发者，id 为签发者 DID
+func NewIssuer(id string, key ed25519.PrivateKey) *Issuer {
+	return &Issuer{id: id, key: key}
+}
+
+// ID 签发者 DID
+func (i *Issuer) ID() string {
+	return i.id
+}
+
+// PublicKey 签名公钥
+func (i *Issuer) PublicKey() ed25519.PublicKey {
+	return i.key.Public().(ed25519.PublicKey)
+}
+
+// Issue 签发凭证，返回 JWT 和凭证内容
+func (i *Issuer) Issue(subject Subject, ttl time.Duration) (string, *Credential, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate credential id: %w", err)
+	}
+
+	// JWT 的时间精确到秒
+	now := time.Now().UTC().Truncate(time.Second)
+	cred := Credential{
+		Context:           []string{ContextV1},
+		ID:                "urn:uuid:" + formatUUID(id),
+		Type:              []string{TypeCredential, TypeCrossDomainAuth},
+		Issuer:            i.id,
+		IssuanceDate:      now,
+		ExpirationDate:    now.Add(ttl),
+		CredentialSubject: subject,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims{
+		VC: cred,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        cred.ID,
+			Issuer:    i.id,
+			Subject:   subject.ID,
+			Audience:  jwt.ClaimStrings{subject.TargetDomain},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(cred.ExpirationDate),
+		},
+	})
+	token.Header["kid"] = i.id + "#" + KeyID
+
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign credential: %w", err)
+	}
+	return signed, &cred, nil
+}
+
+// VerifyOptions 验证选项
+type VerifyOptions struct {
+	Audience string        // 不为空时要求凭证的目标域一致
+	Leeway   time.Duration // 时钟偏差，为0时使用 DefaultLeeway
+}
+
+// Verifier 凭证验证者
+type Verifier struct {
+	issuer string
+	key    ed25519.PublicKey
+}
+
+// NewVerifier 创建验证者，issuer 为信任的签发者 DID，key 为其签名公钥
+func NewVerifier(issuer string, key ed25519.PublicKey) *Verifier {
+	return &Verifier{issuer: issuer, key: key}
+}
+
+// Verify 验证凭证的签名、签发者、有效期和目标域，返回凭证内容
+func (v *Verifier) Verify(token string, opts VerifyOptions) (*Credential, error) {
+	leeway := opts.Leeway
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	c := &claims{}
+	_, err := jwt.ParseWithClaims(token, c, func(t *jwt.Token) (interface{}, error) {
+		return v.key, nil
+	}, parserOpts...)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrTokenNotValidYet):
+			return nil, ErrExpiredCredential
+		case errors.Is(err, jwt.ErrTokenInvalidAudience):
+			return nil, ErrWrongAudience
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+
+	// 凭证内容必须与 JWT 声明一致
+	cred := &c.VC
+	if cred.ID != c.ID || cred.Issuer != c.Issuer || cred.CredentialSubject.ID != c.Subject || !hasType(cred, TypeCrossDomainAuth) {
+		return nil, fmt.Errorf("%w: vc claim does not match the token", ErrInvalidCredential)
+	}
+	if len(c.Audience) != 1 || c.Audience[0] != cred.CredentialSubject.TargetDomain {
+		return nil, fmt.Errorf("%w: audience does not match the target domain", ErrInvalidCredential)
+	}
+	return cred, nil
+}
+
+func hasType(cred *Credential, typ string) bool {
+	for _, t := range cred.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// JWK Ed25519 公钥的 JSON Web Key（RFC 8037）
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// NewJWK 将公钥编码为 JWK
+func NewJWK(key ed25519.PublicKey, kid string) JWK {
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(key),
+		Kid: kid,
+		Alg: jwt.SigningMethodEdDSA.Alg(),
+		Use: "sig",
+	}
+}
+
+// ParseJWK 解析 Ed25519 公钥的 JWK
+func ParseJWK(data []byte) (ed25519.PublicKey, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid jwk: %w", err)
+	}
+	if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" {
+		return nil, errors.New("invalid jwk: expected an OKP Ed25519 key")
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil || len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid jwk: bad x coordinate")
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// formatUUID 将16字节随机数格式化为 UUID v4
+func formatUUID(b []byte) string {
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
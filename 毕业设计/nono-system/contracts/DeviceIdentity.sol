@@ -40,6 +40,7 @@ contract DeviceIdentity {
     event CrossDomainAuthRequested(string indexed did, string sourceDomain, string targetDomain);
     event CrossDomainAuthCompleted(string indexed did, string sourceDomain, string targetDomain, bool authorized);
     event DeviceRevoked(string indexed did, uint256 timestamp);
+    event DeviceTransferred(string indexed did, string fromDomain, string toDomain, uint256 timestamp);
 
     // 存储映射
     mapping(string => Device) public devices;                    // DID => Device
@@ -158,6 +159,25 @@ contract DeviceIdentity {
         emit DeviceRevoked(_did, block.timestamp);
     }
 
+    /**
+     * @dev 记录设备在域之间的迁移，迁移本身由后端审批完成，链上只做存证
+     * @param _did 设备DID
+     * @param _fromDomain 原所属域
+     * @param _toDomain 新所属域
+     */
+    function transferDevice(
+        string memory _did,
+        string memory _fromDomain,
+        string memory _toDomain
+    ) public onlyAuthorizedAdmin {
+        require(devices[_did].exists, "Device does not exist");
+        require(devices[_did].status != DeviceStatus.Revoked, "Device is revoked");
+
+        devices[_did].lastUpdated = block.timestamp;
+
+        emit DeviceTransferred(_did, _fromDomain, _toDomain, block.timestamp);
+    }
+
     /**
      * @dev 查询设备信息
      * @param _did 设备DID
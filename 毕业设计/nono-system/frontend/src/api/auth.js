@@ -6,11 +6,26 @@ export default {
     return api.post('/users/login', data)
   },
 
+  // 登录第二步：提交双因素认证验证码或恢复码
+  loginTwoFactor(data) {
+    return api.post('/users/login/2fa', data)
+  },
+
+  // 注销当前会话
+  logout() {
+    return api.post('/users/logout')
+  },
+
   // 用户注册
   register(data) {
     return api.post('/users/register', data)
   },
 
+  // 管理员创建用户（可指定任意角色）
+  createUser(data) {
+    return api.post('/users', data)
+  },
+
   // 发起跨域认证请求
   requestCrossDomain(data) {
     return api.post('/auth/cross-domain', data)
@@ -2,6 +2,8 @@
 
 # 初始化管理员账号脚本
 # 用法: ./scripts/init_admin.sh [username] [password]
+# 首个管理员由后端启动时按 ADMIN_USERNAME、ADMIN_PASSWORD、ADMIN_EMAIL 环境变量创建，
+# 本脚本检查该账号能否登录并输出 token
 
 API_URL="${API_URL:-http://localhost:8080/api/v1}"
 USERNAME="${1:-admin}"
@@ -23,29 +25,7 @@ if ! curl -s "$API_URL/../health" > /dev/null 2>&1; then
   exit 1
 fi
 
-echo "步骤1: 注册管理员账号..."
-RESPONSE=$(curl -s -X POST "$API_URL/users/register" \
-  -H "Content-Type: application/json" \
-  -d "{
-    \"username\": \"$USERNAME\",
-    \"password\": \"$PASSWORD\",
-    \"email\": \"$EMAIL\",
-    \"role\": \"admin\"
-  }")
-
-if echo "$RESPONSE" | grep -q "error"; then
-  if echo "$RESPONSE" | grep -q "already exists"; then
-    echo "⚠️  用户已存在，尝试登录..."
-  else
-    echo "❌ 注册失败: $RESPONSE"
-    exit 1
-  fi
-else
-  echo "✅ 管理员账号创建成功"
-  echo ""
-fi
-
-echo "步骤2: 登录获取 token..."
+echo "登录获取 token..."
 LOGIN_RESPONSE=$(curl -s -X POST "$API_URL/users/login" \
   -H "Content-Type: application/json" \
   -d "{
@@ -55,6 +35,8 @@ LOGIN_RESPONSE=$(curl -s -X POST "$API_URL/users/login" \
 
 if echo "$LOGIN_RESPONSE" | grep -q "error"; then
   echo "❌ 登录失败: $LOGIN_RESPONSE"
+  echo "   如果还没有管理员，请设置环境变量后重启后端服务："
+  echo "   cd backend && ADMIN_USERNAME=$USERNAME ADMIN_PASSWORD=$PASSWORD ADMIN_EMAIL=$EMAIL go run ./cmd/server"
   exit 1
 fi
 